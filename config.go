@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+)
+
+// restConfigFor builds the client config from the connection flags, or the kubeconfig and master URL flags,
+// falling back to the in-cluster or default config when none is set.
+func restConfigFor(config Config) (*rest.Config, error) {
+	if config.Connection.RESTConfig != nil {
+		return rest.CopyConfig(config.Connection.RESTConfig), nil
+	}
+	if config.Kubeconfig == "" && config.MasterURL == "" {
+		return ctrl.GetConfig()
+	}
+	return clientcmd.BuildConfigFromFlags(config.MasterURL, config.Kubeconfig)
+}
+
+// ClusterConnection connects to a cluster without a kubeconfig, through the API server address and a custom CA and token.
+type ClusterConnection struct {
+	APIServer             string
+	CAFile                string
+	TokenFile             string
+	InsecureSkipTLSVerify bool
+
+	// RESTConfig is assembled from the fields by parseConfiguration, it is nil when no API server is set.
+	RESTConfig *rest.Config
+}
+
+// bindFlags binds the connection flags, named after the prefix, e.g. guest- for --guest-api-server.
+func (c *ClusterConnection) bindFlags(fs *flag.FlagSet, prefix, cluster string) {
+	fs.StringVar(&c.APIServer, prefix+"api-server", "", fmt.Sprintf("Address of the API server of the %s cluster, e.g. https://api.example.com:6443. Connects without a kubeconfig, using --%sca-file and --%stoken-file.", cluster, prefix, prefix))
+	fs.StringVar(&c.CAFile, prefix+"ca-file", "", fmt.Sprintf("Path to the CA bundle verifying the certificate of --%sapi-server. Defaults to the system roots.", prefix))
+	fs.StringVar(&c.TokenFile, prefix+"token-file", "", fmt.Sprintf("Path to the bearer token authenticating to --%sapi-server. It is read again periodically, so that rotated tokens are picked up.", prefix))
+	fs.BoolVar(&c.InsecureSkipTLSVerify, prefix+"insecure-skip-tls-verify", false, fmt.Sprintf("Don't verify the certificate of --%sapi-server. Only meant for testing, must not be combined with --%sca-file.", prefix, prefix))
+}
+
+// complete validates the connection flags named after the prefix and assembles the RESTConfig,
+// kubeconfigFlag is the flag the API server is mutually exclusive with.
+func (c *ClusterConnection) complete(prefix, kubeconfigFlag, kubeconfig string) error {
+	if c.APIServer == "" {
+		if c.CAFile != "" || c.TokenFile != "" || c.InsecureSkipTLSVerify {
+			return fmt.Errorf("--%sca-file, --%stoken-file and --%sinsecure-skip-tls-verify require --%sapi-server", prefix, prefix, prefix, prefix)
+		}
+		return nil
+	}
+	if kubeconfig != "" {
+		return fmt.Errorf("--%sapi-server and --%s are mutually exclusive", prefix, kubeconfigFlag)
+	}
+	if c.InsecureSkipTLSVerify && c.CAFile != "" {
+		return fmt.Errorf("--%sinsecure-skip-tls-verify and --%sca-file are mutually exclusive", prefix, prefix)
+	}
+	for _, file := range []struct{ flag, path string }{{prefix + "ca-file", c.CAFile}, {prefix + "token-file", c.TokenFile}} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			return fmt.Errorf("invalid --%s: %w", file.flag, err)
+		}
+	}
+	c.RESTConfig = &rest.Config{
+		Host:            c.APIServer,
+		BearerTokenFile: c.TokenFile,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAFile:   c.CAFile,
+			Insecure: c.InsecureSkipTLSVerify,
+		},
+	}
+	return nil
+}
+
+type Config struct {
+	LogLevel   string
+	LogEncoder string
+	// LogLevelOverrides are log levels keyed by logger name, loggers not listed use LogLevel.
+	LogLevelOverrides map[string]string
+	// LogSamplingInitial and LogSamplingThereafter configure the log sampling, both zero disable it.
+	LogSamplingInitial    int
+	LogSamplingThereafter int
+	// LogCaller and LogStacktrace add the caller and, for errors, the stack trace to the log entries.
+	LogCaller     bool
+	LogStacktrace bool
+	// LogFiles are written to in addition to stdout, they are rotated once they grow beyond LogMaxSizeMB when it is set.
+	LogFiles      []string
+	LogMaxSizeMB  int
+	LogMaxBackups int
+
+	Kubeconfig string
+	MasterURL  string
+	// InputResourcesFile is a YAML or JSON file of the input resources keyed by the operator name,
+	// it replaces the built-in input resources and is loaded again on SIGHUP.
+	InputResourcesFile string
+	// InputResourcesDir is a directory holding the input resources of every operator in a subdirectory named after it.
+	InputResourcesDir string
+	// GuestKubeconfig is the kubeconfig of the guest cluster observed alongside the management cluster, if any.
+	GuestKubeconfig string
+	// Connection and GuestConnection connect to the management and guest clusters without a kubeconfig.
+	Connection      ClusterConnection
+	GuestConnection ClusterConnection
+	Namespaces      []string
+
+	// MetricsBindAddress is the address the metrics endpoint binds to, "0" disables it.
+	MetricsBindAddress string
+	// HealthProbeBindAddress is the address the /healthz and /readyz endpoints bind to, "0" disables them.
+	HealthProbeBindAddress string
+	// PprofBindAddress is the address the net/http/pprof handlers bind to, "0" disables them.
+	PprofBindAddress string
+
+	// ResyncPeriod is how often the informers replay their cached objects, 0 disables periodic resync.
+	ResyncPeriod time.Duration
+	// FullResyncInterval forces a reconcile of every operator on the interval, zero disables it.
+	FullResyncInterval time.Duration
+	// ReconcileDelay is slept at the start of every reconcile, see DynamicReconciler.ReconcileDelay.
+	ReconcileDelay time.Duration
+
+	// OperatorNameLabel identifies the operator an input resource belongs to, for resources that aren't exact resources.
+	OperatorNameLabel string
+	EventBufferSize   int
+	// InformerStartupConcurrency is the number of informers registered at once while syncing the input resources.
+	InformerStartupConcurrency int
+	// PerObjectRate and PerObjectBurst limit the events dispatched per input resource, see DynamicReconciler.PerObjectRate.
+	PerObjectRate  float64
+	PerObjectBurst int
+	// TolerantPartialSync keeps running without the informers that don't sync in time.
+	TolerantPartialSync bool
+	// MaxConcurrentReconciles is the number of operators reconciled in parallel.
+	MaxConcurrentReconciles int
+	// ReconcileBaseDelay and ReconcileMaxDelay bound the backoff of failed reconciles, zero keeps the default.
+	ReconcileBaseDelay time.Duration
+	ReconcileMaxDelay  time.Duration
+	// EventHandlerStagger spreads the replay of the informers' stores out at startup.
+	EventHandlerStagger time.Duration
+	// MaxCachedObjectsPerGVK fails the initial sync when an informer holds more objects.
+	MaxCachedObjectsPerGVK int
+	// OperatorKind is the kind of the CRs representing operators, written as Kind.version.group, disabled when empty.
+	OperatorKind string
+	// OperatorInputResourcesField is the field of the operator CRs holding their input resources.
+	OperatorInputResourcesField string
+	// MapperRetryMaxInterval caps the backoff between discovery refreshes for a kind that isn't served yet.
+	MapperRetryMaxInterval time.Duration
+
+	// OTLPEndpoint is the OTLP gRPC endpoint the traces are exported to, tracing is disabled when empty.
+	OTLPEndpoint string
+
+	// AuditEvents logs every event dispatched to the controller to a logger named audit.
+	AuditEvents bool
+	// EmitEvents enables Kubernetes events about changed input resources.
+	EmitEvents bool
+	// DebugOperatorsEndpoint serves the snapshots of the input resources of the operators on the metrics endpoint.
+	DebugOperatorsEndpoint bool
+
+	// StripManagedFields and StripStatusKinds drop the managedFields of all cached objects
+	// and the status of the cached objects of the listed kinds, to save memory.
+	StripManagedFields bool
+	StripStatusKinds   []string
+	// TrackStatusKinds log the status of the input resources of the listed kinds on every observation.
+	TrackStatusKinds []string
+
+	// MetadataOnlyExact caches the kinds only referenced by exact resources as metadata only.
+	MetadataOnlyExact bool
+	// FallbackToLiveClient reads exact resources missing from the cache from the API server.
+	FallbackToLiveClient bool
+
+	// Schemes are the well-known API groups registered into the scheme besides core, all client-go groups when empty.
+	Schemes []string
+
+	OutputDir            string
+	CacheObjectMode      dynamiccache.CacheObjectMode
+	UnstructuredFallback bool
+
+	LeaderElect             bool
+	LeaderElectionID        string
+	LeaderElectionNamespace string
+	// DryRun prints the watches the input resources resolve to and exits without starting the manager.
+	DryRun bool
+	// OutputFormat is the format the watches are printed in by DryRun.
+	OutputFormat dynamiccache.OutputFormat
+}
+
+// ParseConfiguration fills the 'OperatorConfig' from the flags passed to the program.
+// Every flag can also be set through an environment variable named after it with the envVarPrefix,
+// e.g. DYNAMIC_CACHE_LOG_LEVEL for --log-level.
+// Flags take precedence over environment variables, which take precedence over the defaults.
+func parseConfiguration(fs *flag.FlagSet, args []string) (Config, error) {
+	config := Config{}
+	fs.StringVar(&config.LogLevel, "log-level", "info", "Log level. Available values: debug | info | warn | error | dpanic | panic | fatal or a numeric value from -9 to 5, where -9 is the most verbose and 5 is the least verbose.")
+	fs.Var((*keyValueValue)(&config.LogLevelOverrides), "log-level-overrides", "Comma-separated list of logger-name=level pairs overriding --log-level for the named loggers, for example dynamic-unstructured=debug,klog=warn. Can be repeated.")
+	fs.IntVar(&config.LogSamplingInitial, "log-sampling-initial", 0, "Number of entries with the same level and message logged per second before sampling starts. Sampling is disabled when both --log-sampling-initial and --log-sampling-thereafter are 0.")
+	fs.IntVar(&config.LogSamplingThereafter, "log-sampling-thereafter", 0, "Once sampling started, only every Nth entry with the same level and message is logged for the rest of the second.")
+	fs.BoolVar(&config.LogCaller, "log-caller", true, "Annotate log entries with the file and line of the caller.")
+	fs.BoolVar(&config.LogStacktrace, "log-stacktrace", true, "Add a stack trace to log entries at error level and above.")
+	fs.Var((*stringSliceValue)(&config.LogFiles), "log-file", "File the logs are written to in addition to stdout, can be repeated. The directory must exist and be writable.")
+	fs.IntVar(&config.LogMaxSizeMB, "log-max-size", 0, "Size in megabytes a log file is rotated at, the rotated file is renamed to <file>.1. 0 disables rotation.")
+	fs.IntVar(&config.LogMaxBackups, "log-max-backups", 3, "Number of rotated log files kept next to each --log-file, older ones are removed.")
+	fs.StringVar(&config.LogEncoder, "log-encoder", "json", "Log encoder. Available values: json | console")
+	fs.StringVar(&config.Kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
+	fs.StringVar(&config.InputResourcesFile, "input-resources-file", "", "Path to a YAML or JSON file of the input resources keyed by the operator name. Sending SIGHUP loads it again and applies the changes without a restart. Defaults to the built-in input resources.")
+	fs.StringVar(&config.InputResourcesDir, "input-resources-dir", "", "Path to a directory holding the input resources of every operator, as written by the multi-operator-manager input-resources command, in <dir>/<operator>/input-resources.yaml (or .yml or .json). Other files and subdirectories without such a file are skipped. Sending SIGHUP loads it again like --input-resources-file. Must not be combined with --input-resources-file.")
+	fs.StringVar(&config.GuestKubeconfig, "guest-kubeconfig", "", "Path to the kubeconfig of a guest cluster whose input resources are observed alongside the management cluster. Disabled when empty, unless --guest-api-server is set.")
+	config.Connection.bindFlags(fs, "", "management")
+	config.GuestConnection.bindFlags(fs, "guest-", "guest")
+	fs.StringVar(&config.MasterURL, "master-url", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig.")
+	fs.Var((*stringSliceValue)(&config.Namespaces), "namespace", "Namespace to restrict the cache to, can be repeated. Cluster-scoped resources are always watched. By default all namespaces are watched.")
+	fs.StringVar(&config.MetricsBindAddress, "metrics-bind-address", "0", "The address the metrics endpoint binds to, for example :8080. \"0\" disables the metrics endpoint.")
+	fs.StringVar(&config.HealthProbeBindAddress, "health-probe-bind-address", "0", "The address the /healthz and /readyz endpoints bind to, for example :8081. \"0\" disables the endpoints. /readyz only passes once the input resources have been synced and while all informers are synced.")
+	fs.StringVar(&config.PprofBindAddress, "pprof-bind-address", "0", "The address the net/http/pprof handlers bind to, for example :6060. \"0\" disables them. A port without a host binds to localhost only.")
+	fs.DurationVar(&config.ResyncPeriod, "resync-period", 10*time.Hour, "Minimum frequency at which the informers replay their cached objects. 0 disables periodic resync.")
+	fs.StringVar(&config.OperatorNameLabel, "operator-name-label", dynamiccache.DefaultOperatorNameLabel, "Label of an input resource identifying the operator it belongs to. Resources that aren't exact resources and don't carry the label aren't mapped to any operator.")
+	fs.DurationVar(&config.FullResyncInterval, "full-resync-interval", 0, "Interval at which every operator is reconciled, regardless of whether its input resources changed. Unlike --resync-period, it doesn't replay the cached objects. 0 disables it.")
+	fs.DurationVar(&config.ReconcileDelay, "reconcile-delay", 0, "Delay at the start of every reconcile, useful to slow the controller down while debugging. 0 disables the delay.")
+	fs.IntVar(&config.InformerStartupConcurrency, "informer-startup-concurrency", dynamiccache.DefaultInformerStartupConcurrency, "Number of informers registered, and waited for, at once while syncing the input resources.")
+	fs.Float64Var(&config.PerObjectRate, "per-object-rate", 0, "Number of events per second dispatched for a single input resource. Events over the rate are coalesced, only the latest one is dispatched once the resource is allowed again. 0 disables the limit.")
+	fs.IntVar(&config.PerObjectBurst, "per-object-burst", 1, "Number of events dispatched for a single input resource at once before --per-object-rate applies.")
+	fs.BoolVar(&config.TolerantPartialSync, "tolerate-partial-sync", false, "Complete the sync of the input resources without the informers that don't sync within 2m instead of exiting. They keep syncing in the background, /readyz and the informer synced metric report them until they do.")
+	fs.IntVar(&config.MaxConcurrentReconciles, "max-concurrent-reconciles", 1, "Number of operators reconciled in parallel. An operator is never reconciled by several workers at once.")
+	fs.DurationVar(&config.ReconcileBaseDelay, "reconcile-base-delay", 0, "Delay before an operator whose reconcile failed is reconciled again, doubled on every consecutive failure up to --reconcile-max-delay. When both are 0 the controller-runtime default rate limiter is used, otherwise an unset one defaults to 5ms and 1000s respectively.")
+	fs.DurationVar(&config.ReconcileMaxDelay, "reconcile-max-delay", 0, "Longest delay before an operator whose reconcile failed is reconciled again, see --reconcile-base-delay.")
+	fs.DurationVar(&config.EventHandlerStagger, "event-handler-stagger", 0, "Delay adding the event handler of every informer by a random duration of up to this long, so that the informers syncing at once don't replay their objects into the event buffer at the same time. 0 disables the delay.")
+	fs.IntVar(&config.MaxCachedObjectsPerGVK, "max-cached-objects-per-gvk", 0, "Exit when, once synced, the informer of a kind holds more objects, e.g. because a label selector selects all secrets of the cluster by mistake. The error names the kind and its count. 0 disables the limit.")
+	fs.StringVar(&config.OperatorKind, "operator-kind", "", "Kind of the CRs representing operators, written as Kind.version.group, e.g. Operator.v1.example.com. The input resources of every CR are observed for an operator named after it, <namespace>/<name> for namespaced CRs, and follow the CR's changes. Disabled when empty.")
+	fs.StringVar(&config.OperatorInputResourcesField, "operator-input-resources-field", dynamiccache.DefaultOperatorInputResourcesField, "Dot separated path of the field of the --operator-kind CRs holding their input resources.")
+	fs.DurationVar(&config.MapperRetryMaxInterval, "mapper-retry-max-interval", dynamiccache.DefaultMapperRetryMaxInterval, "Longest interval between two discovery refreshes for a kind or resource that isn't served yet, e.g. a CRD that isn't installed. The interval starts at 1s and doubles, with jitter, on every miss.")
+	fs.IntVar(&config.EventBufferSize, "event-buffer-size", dynamiccache.DefaultEventBufferSize, "Number of events buffered between the informers and the controller. When the buffer is full the informers block until the controller catches up, no event is dropped.")
+	fs.StringVar(&config.OTLPEndpoint, "otlp-endpoint", "", "OTLP gRPC endpoint, for example localhost:4317, the reconcile and cache read spans are exported to. The standard OTEL_EXPORTER_OTLP_* environment variables configure the exporter further. Tracing is disabled when empty.")
+	fs.BoolVar(&config.AuditEvents, "audit-events", false, "Log every event dispatched to the controller, with the operators it matched, to a logger named audit.")
+	fs.BoolVar(&config.DebugOperatorsEndpoint, "debug-operators-endpoint", false, "Serve what the cache holds of the input resources of an operator on /debug/operators?operator=<name> of the metrics endpoint. The values of Secrets are redacted. The metrics endpoint doesn't authenticate its clients, so only enable it while debugging.")
+	fs.BoolVar(&config.EmitEvents, "emit-events", false, "Emit a Kubernetes event on an input resource whenever its resourceVersion changes. Events about the same resource are emitted at most once every 30s.")
+	fs.BoolVar(&config.StripManagedFields, "strip-managed-fields", false, "Drop metadata.managedFields from the cached objects to save memory.")
+	fs.Var((*stringSliceValue)(&config.StripStatusKinds), "strip-status-kind", "Kind whose status is dropped from the cached objects, written as Kind.group, e.g. Deployment.apps, or Kind for the core group. Can be repeated.")
+	fs.Var((*stringSliceValue)(&config.TrackStatusKinds), "track-status-kind", "Kind whose status is logged every time its input resources are read, written as Kind.group like --strip-status-kind. Changes to the status show up in the logged diffs too. Can be repeated, must not be stripped with --strip-status-kind.")
+	fs.BoolVar(&config.MetadataOnlyExact, "metadata-only-exact", false, "Cache the kinds only referenced by exact resources as metadata only, restricted to the declared names. The whole object is read from the API server when its resourceVersion changed.")
+	fs.BoolVar(&config.FallbackToLiveClient, "fallback-to-live-client", false, "Read an exact resource missing from the cache once from the API server, e.g. when it was just created and the cache hasn't observed it yet. The live reads are limited to 1 per second with bursts of 5, past the limit the resource is reported as not found.")
+	fs.StringVar(&config.OutputDir, "output-dir", "", "Directory the observed input resources are written to as <operator>/<group>/<kind>/<namespace>_<name>.json. Disabled when empty.")
+	fs.StringVar((*string)(&config.CacheObjectMode), "cache-object-mode", string(dynamiccache.TypedCacheObjectMode), "Whether the input resources are watched and read as typed or unstructured objects. Available values: typed | unstructured. The unstructured mode doesn't require the types to be registered in the scheme.")
+	fs.Var((*stringSliceValue)(&config.Schemes), "schemes", "Comma-separated list of well-known API groups whose types are registered into the scheme besides core, e.g. apps,rbac,apiextensions. Can be repeated. Kinds of other groups are read as unstructured objects, see --unstructured-fallback. All client-go groups and apiextensions are registered when empty.")
+	fs.BoolVar(&config.UnstructuredFallback, "unstructured-fallback", true, "Read and watch input resources whose types aren't registered in the scheme as unstructured objects, per kind, with a warning the first time. The kinds that fell back are listed in the startup summary. Registered types are always read as typed objects. When disabled, a kind missing from the scheme fails the sync of the input resources.")
+	fs.BoolVar(&config.DryRun, "dry-run", false, "Validate and resolve the input resources against the cluster, print the watches they resolve to in the --output-format and exit without starting any informer. Exits non-zero when the input resources are invalid.")
+	fs.StringVar((*string)(&config.OutputFormat), "output-format", string(dynamiccache.JSONOutputFormat), "Format the watches are printed in by --dry-run. Available values: json | table. The /debug/watches endpoint takes the same values through its output query parameter.")
+	fs.BoolVar(&config.LeaderElect, "leader-elect", false, "Enable leader election, only the leader observes the input resources.")
+	fs.StringVar(&config.LeaderElectionID, "leader-election-id", "controller-runtime-dynamic-cache", "Name of the lease used for leader election.")
+	fs.StringVar(&config.LeaderElectionNamespace, "leader-election-namespace", "", "Namespace of the lease used for leader election. Defaults to the namespace the process runs in.")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, fmt.Errorf("failed to parse arguments: %w", err)
+	}
+	if err := setUnsetFlagsFromEnv(fs); err != nil {
+		return Config{}, err
+	}
+	if config.LogSamplingInitial < 0 || config.LogSamplingThereafter < 0 {
+		return Config{}, fmt.Errorf("--log-sampling-initial and --log-sampling-thereafter must not be negative, got %d and %d", config.LogSamplingInitial, config.LogSamplingThereafter)
+	}
+	if config.LogMaxSizeMB < 0 || config.LogMaxBackups < 0 {
+		return Config{}, fmt.Errorf("--log-max-size and --log-max-backups must not be negative, got %d and %d", config.LogMaxSizeMB, config.LogMaxBackups)
+	}
+	if config.CacheObjectMode != dynamiccache.TypedCacheObjectMode && config.CacheObjectMode != dynamiccache.UnstructuredCacheObjectMode {
+		return Config{}, fmt.Errorf("--cache-object-mode can only be either %q or %q, got %q", dynamiccache.TypedCacheObjectMode, dynamiccache.UnstructuredCacheObjectMode, config.CacheObjectMode)
+	}
+	if config.OutputFormat != dynamiccache.JSONOutputFormat && config.OutputFormat != dynamiccache.TableOutputFormat {
+		return Config{}, fmt.Errorf("--output-format can only be either %q or %q, got %q", dynamiccache.JSONOutputFormat, dynamiccache.TableOutputFormat, config.OutputFormat)
+	}
+	kubeconfigFlag, kubeconfig := "kubeconfig", config.Kubeconfig
+	if config.MasterURL != "" {
+		kubeconfigFlag, kubeconfig = "master-url", config.MasterURL
+	}
+	if err := config.Connection.complete("", kubeconfigFlag, kubeconfig); err != nil {
+		return Config{}, err
+	}
+	if err := config.GuestConnection.complete("guest-", "guest-kubeconfig", config.GuestKubeconfig); err != nil {
+		return Config{}, err
+	}
+	if config.InputResourcesFile != "" && config.InputResourcesDir != "" {
+		return Config{}, fmt.Errorf("--input-resources-file and --input-resources-dir are mutually exclusive")
+	}
+	for _, group := range config.Schemes {
+		if _, ok := dynamiccache.WellKnownSchemes[group]; !ok {
+			return Config{}, fmt.Errorf("--schemes got the unknown group %q, available groups: %s", group, strings.Join(sets.List(sets.KeySet(dynamiccache.WellKnownSchemes)), " | "))
+		}
+	}
+	if config.InformerStartupConcurrency <= 0 {
+		return Config{}, fmt.Errorf("--informer-startup-concurrency must be greater than 0, got %d", config.InformerStartupConcurrency)
+	}
+	if config.PerObjectRate < 0 {
+		return Config{}, fmt.Errorf("--per-object-rate must not be negative, got %v", config.PerObjectRate)
+	}
+	if stripped := dynamiccache.GroupKindsFor(config.StripStatusKinds).Intersection(dynamiccache.GroupKindsFor(config.TrackStatusKinds)); stripped.Len() > 0 {
+		var kinds []string
+		for groupKind := range stripped {
+			kinds = append(kinds, groupKind.String())
+		}
+		sort.Strings(kinds)
+		return Config{}, fmt.Errorf("--track-status-kind can't track the status stripped by --strip-status-kind, got %v in both", kinds)
+	}
+	if config.MaxConcurrentReconciles <= 0 {
+		return Config{}, fmt.Errorf("--max-concurrent-reconciles must be greater than 0, got %d", config.MaxConcurrentReconciles)
+	}
+	if config.ReconcileBaseDelay < 0 || config.ReconcileMaxDelay < 0 {
+		return Config{}, fmt.Errorf("--reconcile-base-delay and --reconcile-max-delay must not be negative, got %v and %v", config.ReconcileBaseDelay, config.ReconcileMaxDelay)
+	}
+	if config.ReconcileBaseDelay > 0 && config.ReconcileMaxDelay > 0 && config.ReconcileBaseDelay > config.ReconcileMaxDelay {
+		return Config{}, fmt.Errorf("--reconcile-base-delay must not be greater than --reconcile-max-delay, got %v and %v", config.ReconcileBaseDelay, config.ReconcileMaxDelay)
+	}
+	if config.EventHandlerStagger < 0 {
+		return Config{}, fmt.Errorf("--event-handler-stagger must not be negative, got %v", config.EventHandlerStagger)
+	}
+	if config.MaxCachedObjectsPerGVK < 0 {
+		return Config{}, fmt.Errorf("--max-cached-objects-per-gvk must not be negative, got %d", config.MaxCachedObjectsPerGVK)
+	}
+	if config.OperatorKind != "" {
+		if gvk, _ := schema.ParseKindArg(config.OperatorKind); gvk == nil {
+			return Config{}, fmt.Errorf("--operator-kind must be written as Kind.version.group, got %q", config.OperatorKind)
+		}
+		if config.OperatorInputResourcesField == "" {
+			return Config{}, fmt.Errorf("--operator-input-resources-field must not be empty")
+		}
+	}
+	if config.MapperRetryMaxInterval <= 0 {
+		return Config{}, fmt.Errorf("--mapper-retry-max-interval must be greater than 0, got %v", config.MapperRetryMaxInterval)
+	}
+	if config.PerObjectBurst <= 0 {
+		return Config{}, fmt.Errorf("--per-object-burst must be greater than 0, got %d", config.PerObjectBurst)
+	}
+	if config.EventBufferSize <= 0 {
+		return Config{}, fmt.Errorf("--event-buffer-size must be greater than 0, got %d", config.EventBufferSize)
+	}
+	pprofBindAddress, err := localhostIfNoHost(config.PprofBindAddress)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid --pprof-bind-address: %w", err)
+	}
+	config.PprofBindAddress = pprofBindAddress
+	if config.ResyncPeriod < 0 {
+		return Config{}, fmt.Errorf("--resync-period must not be negative, got %v", config.ResyncPeriod)
+	}
+	if config.FullResyncInterval < 0 {
+		return Config{}, fmt.Errorf("--full-resync-interval must not be negative, got %v", config.FullResyncInterval)
+	}
+	if config.ReconcileDelay < 0 {
+		return Config{}, fmt.Errorf("--reconcile-delay must not be negative, got %v", config.ReconcileDelay)
+	}
+
+	return config, nil
+}
+
+// setUnsetFlagsFromEnv sets the flags that weren't passed on the command line from their environment variables.
+func setUnsetFlagsFromEnv(fs *flag.FlagSet) error {
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if setFlags[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envVarForFlag(f.Name))
+		if !ok {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, envVarForFlag(f.Name), err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// envVarPrefix prefixes the environment variables of the flags, so that generic variables
+// the container already has, e.g. NAMESPACE or KUBECONFIG, don't change the configuration.
+const envVarPrefix = "DYNAMIC_CACHE_"
+
+func envVarForFlag(name string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// localhostIfNoHost binds an address without a host, like ":6060", to localhost.
+// Disabled addresses ("" and "0") are returned unchanged.
+func localhostIfNoHost(address string) (string, error) {
+	if address == "" || address == "0" {
+		return address, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// keyValueValue is a flag.Value collecting comma-separated key=value pairs of a repeatable flag.
+type keyValueValue map[string]string
+
+func (m *keyValueValue) String() string {
+	pairs := make([]string, 0, len(*m))
+	for key, value := range *m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *keyValueValue) Set(value string) error {
+	if *m == nil {
+		*m = map[string]string{}
+	}
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+		(*m)[key] = val
+	}
+	return nil
+}
+
+// stringSliceValue is a flag.Value collecting the values of a repeatable flag,
+// a single value can also hold a comma-separated list.
+type stringSliceValue []string
+
+func (s *stringSliceValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceValue) Set(value string) error {
+	*s = append(*s, strings.Split(value, ",")...)
+	return nil
+}
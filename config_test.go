@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestParseConfigurationPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want time.Duration
+	}{
+		{
+			name: "default",
+			want: 10 * time.Hour,
+		},
+		{
+			name: "environment variable over the default",
+			env:  map[string]string{"DYNAMIC_CACHE_RESYNC_PERIOD": "1h"},
+			want: time.Hour,
+		},
+		{
+			name: "flag over the environment variable",
+			args: []string{"--resync-period=2h"},
+			env:  map[string]string{"DYNAMIC_CACHE_RESYNC_PERIOD": "1h"},
+			want: 2 * time.Hour,
+		},
+		{
+			name: "flag set to the default over the environment variable",
+			args: []string{"--resync-period=10h"},
+			env:  map[string]string{"DYNAMIC_CACHE_RESYNC_PERIOD": "1h"},
+			want: 10 * time.Hour,
+		},
+		{
+			name: "environment variable without the prefix is ignored",
+			env:  map[string]string{"RESYNC_PERIOD": "1h"},
+			want: 10 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			config, err := parseConfiguration(flag.NewFlagSet("test", flag.ContinueOnError), tt.args)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if config.ResyncPeriod != tt.want {
+				t.Errorf("expected the resync period %v, got %v", tt.want, config.ResyncPeriod)
+			}
+		})
+	}
+}
+
+func TestParseConfigurationGenericEnvironmentVariables(t *testing.T) {
+	// variables a container commonly has must not configure the flags of the same name
+	t.Setenv("NAMESPACE", "ns")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("KUBECONFIG", "/nonexistent")
+
+	config, err := parseConfiguration(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Namespaces) != 0 || config.DryRun || config.Kubeconfig != "" {
+		t.Errorf("expected the generic environment variables to be ignored, got namespaces %v, dry run %v and kubeconfig %q", config.Namespaces, config.DryRun, config.Kubeconfig)
+	}
+}
+
+func TestParseConfigurationInvalidEnvironmentVariable(t *testing.T) {
+	t.Setenv("DYNAMIC_CACHE_RESYNC_PERIOD", "soon")
+
+	if _, err := parseConfiguration(flag.NewFlagSet("test", flag.ContinueOnError), nil); err == nil {
+		t.Fatal("expected an invalid environment variable to be reported")
+	}
+}
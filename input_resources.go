@@ -0,0 +1,65 @@
+package main
+
+import (
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var inputResources = map[string]*libraryinputresources.InputResources{
+	"example-operator": {
+		ApplyConfigurationResources: libraryinputresources.ResourceList{
+			ExactResources: []libraryinputresources.ExactResourceID{
+				{
+					InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
+						Group:    "",
+						Version:  "v1",
+						Resource: "configmaps",
+					},
+					Namespace: "kube-system",
+					Name:      "kube-root-ca.crt",
+				},
+				{
+					InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
+						Group:    "",
+						Version:  "v1",
+						Resource: "secrets",
+					},
+					Namespace: "kube-system",
+					Name:      "bootstrap-token-abcdef",
+				},
+				{
+					InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
+						Group:    "",
+						Version:  "v1",
+						Resource: "nodes",
+					},
+					Name: "kind-control-plane",
+				},
+			},
+			LabelSelectedResources: []libraryinputresources.LabelSelectedResource{
+				{
+					InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
+						Group:    "",
+						Version:  "v1",
+						Resource: "pods",
+					},
+					Namespace: "kube-system",
+					LabelSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"tier": "control-plane"},
+					},
+				},
+			},
+		},
+	},
+}
+
+// guestClusterInputResources are the input resources the operators declare on the guest cluster, keyed by the operator name.
+var guestClusterInputResources = map[string]*libraryinputresources.InputResources{}
+
+func discoverInputResources() map[string]*libraryinputresources.InputResources {
+	return inputResources
+}
+
+func discoverGuestClusterInputResources() map[string]*libraryinputresources.InputResources {
+	return guestClusterInputResources
+}
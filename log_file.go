@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// rotatingFileScheme is the zap sink scheme of log files rotated by size.
+const rotatingFileScheme = "rotating"
+
+var registerRotatingFileSinkOnce sync.Once
+
+// logFileOutputPaths returns the zap output paths of the log files,
+// when maxSizeMB is positive the files are rotated once they would grow beyond it.
+func logFileOutputPaths(paths []string, maxSizeMB, maxBackups int) ([]string, error) {
+	var outputPaths []string
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkWritableDir(filepath.Dir(absPath)); err != nil {
+			return nil, err
+		}
+		if maxSizeMB <= 0 {
+			outputPaths = append(outputPaths, absPath)
+			continue
+		}
+		var registerErr error
+		registerRotatingFileSinkOnce.Do(func() {
+			registerErr = zap.RegisterSink(rotatingFileScheme, newRotatingFileSink)
+		})
+		if registerErr != nil {
+			return nil, registerErr
+		}
+		u := url.URL{
+			Scheme:   rotatingFileScheme,
+			Path:     absPath,
+			RawQuery: url.Values{"maxSize": {strconv.Itoa(maxSizeMB)}, "maxBackups": {strconv.Itoa(maxBackups)}}.Encode(),
+		}
+		outputPaths = append(outputPaths, u.String())
+	}
+	return outputPaths, nil
+}
+
+// checkWritableDir fails when no file can be created in the directory.
+func checkWritableDir(dir string) error {
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("log directory %q is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func newRotatingFileSink(u *url.URL) (zap.Sink, error) {
+	maxSizeMB, err := strconv.Atoi(u.Query().Get("maxSize"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxSize of %q: %w", u.String(), err)
+	}
+	maxBackups, err := strconv.Atoi(u.Query().Get("maxBackups"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid maxBackups of %q: %w", u.String(), err)
+	}
+	f := &rotatingFile{path: u.Path, maxSize: int64(maxSizeMB) * 1024 * 1024, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// rotatingFile is a log file that is renamed to <path>.1 once a write would grow it beyond maxSize,
+// the previous backups are shifted to <path>.2 and so on, keeping at most maxBackups of them.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Sync() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.file.Sync()
+}
+
+func (f *rotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.file.Close()
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(f.path, i), backupPath(f.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, backupPath(f.path, 1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return f.open()
+}
+
+func backupPath(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
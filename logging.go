@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+)
+
+func initCustomZapLogger(level, encoding string, opts logOptions) (*zap.Logger, error) {
+	lv := zap.AtomicLevel{}
+
+	i64, err := strconv.ParseInt(level, 10, 8)
+	numericLevel := int8(i64)
+	if err != nil {
+		// not a numeric level, try to unmarshal it as a zapcore.Level ("debug", "info", "warn", "error", "dpanic", "panic", or "fatal")
+		err := lv.UnmarshalText([]byte(strings.ToLower(level)))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// numeric level:
+		// 1. configure klog if the numeric log level is negative and the absolute value of the negative numeric value represents the klog level.
+		// 2. configure the atomic zap level based on the numeric value (5..-9).
+
+		var klogLevel int8 = 0
+		if numericLevel < 0 {
+			klogLevel = -numericLevel
+		}
+
+		klogFlagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		klog.InitFlags(klogFlagSet)
+		if err := klogFlagSet.Set("v", strconv.Itoa(int(klogLevel))); err != nil {
+			return nil, err
+		}
+
+		lv = zap.NewAtomicLevelAt(zapcore.Level(numericLevel))
+	}
+
+	enc := strings.ToLower(encoding)
+	if enc != "json" && enc != "console" {
+		return nil, errors.New("'encoding' parameter can only by either 'json' or 'console'")
+	}
+
+	overrides, err := parseLogLevelOverrides(opts.levelOverrides)
+	if err != nil {
+		return nil, err
+	}
+	baseLevel := lv.Level()
+	lowestLevel := baseLevel
+	for _, overrideLevel := range overrides {
+		lowestLevel = min(lowestLevel, overrideLevel)
+	}
+
+	cfg := zap.Config{
+		Level:             zap.NewAtomicLevelAt(lowestLevel),
+		OutputPaths:       []string{"stdout"},
+		DisableCaller:     opts.disableCaller,
+		DisableStacktrace: opts.disableStacktrace,
+		Encoding:          enc,
+		EncoderConfig: zapcore.EncoderConfig{
+			MessageKey:  "msg",
+			LevelKey:    "level",
+			EncodeLevel: zapcore.CapitalLevelEncoder,
+			TimeKey:     "time",
+			EncodeTime:  zapcore.ISO8601TimeEncoder,
+			// the keys are required for the caller and the stack trace to be rendered
+			CallerKey:     "caller",
+			EncodeCaller:  zapcore.ShortCallerEncoder,
+			StacktraceKey: "stacktrace",
+		},
+	}
+	cfg.Sampling = opts.samplingConfig()
+	logFiles, err := logFileOutputPaths(opts.files, opts.maxSizeMB, opts.maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	cfg.OutputPaths = append(cfg.OutputPaths, logFiles...)
+	if len(overrides) == 0 {
+		cfg.Level = lv
+		return cfg.Build()
+	}
+	return cfg.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &namedLevelCore{Core: core, base: baseLevel, levels: overrides}
+	}))
+}
+
+// logOptions are the optional settings of the logger built by initCustomZapLogger.
+type logOptions struct {
+	// levelOverrides sets the level of loggers by name, see namedLevelCore
+	levelOverrides map[string]string
+	// samplingInitial and samplingThereafter configure zap's sampling, both zero disable it
+	samplingInitial    int
+	samplingThereafter int
+	// disableCaller and disableStacktrace drop the caller and the stack trace from the entries
+	disableCaller     bool
+	disableStacktrace bool
+	// files are written to in addition to stdout, rotated by size when maxSizeMB is positive, see logFileOutputPaths
+	files      []string
+	maxSizeMB  int
+	maxBackups int
+}
+
+func (o logOptions) samplingConfig() *zap.SamplingConfig {
+	if o.samplingInitial == 0 && o.samplingThereafter == 0 {
+		return nil
+	}
+	return &zap.SamplingConfig{Initial: o.samplingInitial, Thereafter: o.samplingThereafter}
+}
+
+// parseLogLevel parses a level the way --log-level does, a zapcore level name or a numeric value from -9 to 5.
+func parseLogLevel(level string) (zapcore.Level, error) {
+	if i64, err := strconv.ParseInt(level, 10, 8); err == nil {
+		return zapcore.Level(i64), nil
+	}
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return 0, err
+	}
+	return lvl, nil
+}
+
+// parseLogLevelOverrides parses the levels of --log-level-overrides keyed by logger name.
+func parseLogLevelOverrides(overrides map[string]string) (map[string]zapcore.Level, error) {
+	levels := map[string]zapcore.Level{}
+	for name, level := range overrides {
+		lvl, err := parseLogLevel(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %q for logger %q: %w", level, name, err)
+		}
+		levels[name] = lvl
+	}
+	return levels, nil
+}
+
+// namedLevelCore filters the entries of the wrapped core by the level configured for their logger name.
+//
+// Logger names are dot separated, e.g. "ctrl.dynamic-unstructured", a level applies to a logger
+// whose full name or any name segment matches, the innermost segment wins.
+// Loggers without a matching level use the base level.
+// The wrapped core must enable the lowest of all levels.
+type namedLevelCore struct {
+	zapcore.Core
+	base   zapcore.LevelEnabler
+	levels map[string]zapcore.Level
+}
+
+func (c *namedLevelCore) levelFor(loggerName string) zapcore.LevelEnabler {
+	if lvl, ok := c.levels[loggerName]; ok {
+		return lvl
+	}
+	segments := strings.Split(loggerName, ".")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if lvl, ok := c.levels[segments[i]]; ok {
+			return lvl
+		}
+	}
+	return c.base
+}
+
+func (c *namedLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &namedLevelCore{Core: c.Core.With(fields), base: c.base, levels: c.levels}
+}
+
+func (c *namedLevelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levelFor(entry.LoggerName).Enabled(entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -1,60 +1,46 @@
 package main
 
 import (
-	"errors"
+	"context"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"strconv"
-	"strings"
 
 	"github.com/go-logr/zapr"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 
 	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
-)
 
-var inputResources = []libraryinputresources.ExactResourceID{
-	{
-		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
-			Group:    "",
-			Version:  "v1",
-			Resource: "configmaps",
-		},
-		Namespace: "kube-system",
-		Name:      "kube-root-ca.crt",
-	},
-	{
-		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
-			Group:    "",
-			Version:  "v1",
-			Resource: "secrets",
-		},
-		Namespace: "kube-system",
-		Name:      "bootstrap-token-abcdef",
-	},
-	{
-		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{
-			Group:    "",
-			Version:  "v1",
-			Resource: "nodes",
-		},
-		Name: "kind-control-plane",
-	},
-}
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+)
 
 func main() {
-	config, err := parseConfiguration(flag.CommandLine, os.Args[1:])
+	// controller-runtime registers its own kubeconfig flag on flag.CommandLine,
+	// use a dedicated flag set so that the client config is built from our flags only
+	config, err := parseConfiguration(flag.NewFlagSet(os.Args[0], flag.ExitOnError), os.Args[1:])
 	if err != nil {
 		panic(err)
 	}
-	logger, err := initCustomZapLogger(config.LogLevel, config.LogEncoder)
+	logger, err := initCustomZapLogger(config.LogLevel, config.LogEncoder, logOptions{
+		levelOverrides:     config.LogLevelOverrides,
+		samplingInitial:    config.LogSamplingInitial,
+		samplingThereafter: config.LogSamplingThereafter,
+		disableCaller:      !config.LogCaller,
+		disableStacktrace:  !config.LogStacktrace,
+		files:              config.LogFiles,
+		maxSizeMB:          config.LogMaxSizeMB,
+		maxBackups:         config.LogMaxBackups,
+	})
 	if err != nil {
 		panic(err)
 	}
@@ -62,101 +48,205 @@ func main() {
 	ctrl.SetLogger(logrLogger.WithName("ctrl"))
 	klog.SetLogger(logrLogger.WithName("klog"))
 
-	scheme := runtime.NewScheme()
-	if err := corev1.AddToScheme(scheme); err != nil {
+	scheme, err := dynamiccache.NewScheme()
+	if len(config.Schemes) > 0 {
+		scheme, err = dynamiccache.NewSchemeFor(config.Schemes)
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:  scheme,
-		Metrics: server.Options{BindAddress: "0"},
+	if config.MetricsBindAddress != "0" {
+		dynamiccache.RegisterMetrics()
+	}
+
+	restConfig, err := restConfigFor(config)
+	if err != nil {
+		os.Exit(1)
+	}
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		os.Exit(1)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfigAndClient(restConfig, httpClient)
+	if err != nil {
+		os.Exit(1)
+	}
+	mapper := dynamiccache.NewRefreshingRESTMapper(discoveryClient, dynamiccache.RefreshingRESTMapperOptions{
+		Log:              ctrl.Log.WithName("rest-mapper"),
+		MaxRetryInterval: config.MapperRetryMaxInterval,
 	})
+	loadInputResources := func() (map[string]*libraryinputresources.InputResources, error) {
+		switch {
+		case config.InputResourcesFile != "":
+			return dynamiccache.LoadInputResourcesFile(config.InputResourcesFile)
+		case config.InputResourcesDir != "":
+			return dynamiccache.LoadInputResourcesDir(ctrl.Log.WithName("input-resources"), config.InputResourcesDir)
+		default:
+			return discoverInputResources(), nil
+		}
+	}
+	initialInputResources, err := loadInputResources()
 	if err != nil {
+		if config.DryRun {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			ctrl.Log.Error(err, "failed to load the input resources")
+		}
 		os.Exit(1)
 	}
-
-	reconciler := &DynamicReconciler{
-		Log:    ctrl.Log.WithName("dynamic-unstructured"),
-		Mapper: mgr.GetRESTMapper(),
-		Scheme: scheme,
-		Cache:  mgr.GetCache(),
+	if config.DryRun {
+		err := dynamiccache.DryRun(os.Stdout, config.OutputFormat, dynamiccache.PlanWatchesOptions{
+			Log:            ctrl.Log.WithName("dry-run"),
+			Discovery:      discoveryClient,
+			Mapper:         mapper,
+			InputResources: initialInputResources,
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-
-	if err := reconciler.SetupWithManager(mgr); err != nil {
+	objectOptions := dynamiccache.ObjectOptions{Mode: config.CacheObjectMode, UnstructuredFallback: config.UnstructuredFallback}
+	byObject, err := dynamiccache.InputResourceCacheOptions(mapper, scheme, objectOptions, initialInputResources)
+	if err != nil {
 		os.Exit(1)
 	}
-
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := dynamiccache.ValidateInputResourceNamespaces(config.Namespaces, initialInputResources); err != nil {
 		os.Exit(1)
 	}
-}
 
-func initCustomZapLogger(level, encoding string) (*zap.Logger, error) {
-	lv := zap.AtomicLevel{}
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+		Scheme: scheme,
+		MapperProvider: func(*rest.Config, *http.Client) (meta.RESTMapper, error) {
+			return mapper, nil
+		},
+		Cache: cache.Options{
+			SyncPeriod:        &config.ResyncPeriod,
+			DefaultNamespaces: dynamiccache.DefaultNamespacesFor(config.Namespaces),
+			ByObject:          byObject,
+			DefaultTransform:  dynamiccache.InputResourceTransform(scheme, config.StripManagedFields, dynamiccache.GroupKindsFor(config.StripStatusKinds)),
+			// the informers back off and reconnect on their own, the handler makes the dropped watches observable
+			DefaultWatchErrorHandler: dynamiccache.NewWatchErrorHandler(ctrl.Log.WithName("watch-errors"), "management"),
+		},
+		Metrics:                server.Options{BindAddress: config.MetricsBindAddress},
+		HealthProbeBindAddress: config.HealthProbeBindAddress,
+		PprofBindAddress:       config.PprofBindAddress,
 
-	i64, err := strconv.ParseInt(level, 10, 8)
-	numericLevel := int8(i64)
+		LeaderElection:          config.LeaderElect,
+		LeaderElectionID:        config.LeaderElectionID,
+		LeaderElectionNamespace: config.LeaderElectionNamespace,
+	})
 	if err != nil {
-		// not a numeric level, try to unmarshal it as a zapcore.Level ("debug", "info", "warn", "error", "dpanic", "panic", or "fatal")
-		err := lv.UnmarshalText([]byte(strings.ToLower(level)))
+		os.Exit(1)
+	}
+	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		os.Exit(1)
+	}
+	var guestCluster cluster.Cluster
+	if config.GuestKubeconfig != "" || config.GuestConnection.RESTConfig != nil {
+		guestCluster, err = dynamiccache.NewGuestCluster(dynamiccache.GuestClusterOptions{
+			Kubeconfig: config.GuestKubeconfig,
+			RESTConfig: config.GuestConnection.RESTConfig,
+			Scheme:     scheme,
+			CacheOptions: cache.Options{
+				SyncPeriod:               &config.ResyncPeriod,
+				DefaultTransform:         dynamiccache.InputResourceTransform(scheme, config.StripManagedFields, dynamiccache.GroupKindsFor(config.StripStatusKinds)),
+				DefaultWatchErrorHandler: dynamiccache.NewWatchErrorHandler(ctrl.Log.WithName("watch-errors"), "guest"),
+			},
+			ObjectOptions:  objectOptions,
+			InputResources: discoverGuestClusterInputResources(),
+			MapperOptions: dynamiccache.RefreshingRESTMapperOptions{
+				Log:              ctrl.Log.WithName("rest-mapper").WithValues("cluster", "guest"),
+				MaxRetryInterval: config.MapperRetryMaxInterval,
+			},
+		})
 		if err != nil {
-			return nil, err
+			os.Exit(1)
 		}
-	} else {
-		// numeric level:
-		// 1. configure klog if the numeric log level is negative and the absolute value of the negative numeric value represents the klog level.
-		// 2. configure the atomic zap level based on the numeric value (5..-9).
-
-		var klogLevel int8 = 0
-		if numericLevel < 0 {
-			klogLevel = -numericLevel
+		if err := mgr.Add(guestCluster); err != nil {
+			os.Exit(1)
 		}
+	}
 
-		klogFlagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-		klog.InitFlags(klogFlagSet)
-		if err := klogFlagSet.Set("v", strconv.Itoa(int(klogLevel))); err != nil {
-			return nil, err
-		}
+	reconciler := &dynamiccache.DynamicReconciler{
+		Log:    ctrl.Log.WithName("dynamic-unstructured"),
+		Mapper: mgr.GetRESTMapper(),
+		Scheme: scheme,
+		Cache:  mgr.GetCache(),
 
-		lv = zap.NewAtomicLevelAt(zapcore.Level(numericLevel))
-	}
+		APIReader: mgr.GetAPIReader(),
 
-	enc := strings.ToLower(encoding)
-	if enc != "json" && enc != "console" {
-		return nil, errors.New("'encoding' parameter can only by either 'json' or 'console'")
-	}
+		InputResources: initialInputResources,
+		// the manager's cache is restricted with InputResourceCacheOptions above
+		CacheRestrictedToInputResources: true,
 
-	cfg := zap.Config{
-		Level:             lv,
-		OutputPaths:       []string{"stdout"},
-		DisableCaller:     false,
-		DisableStacktrace: false,
-		Encoding:          enc,
-		EncoderConfig: zapcore.EncoderConfig{
-			MessageKey:  "msg",
-			LevelKey:    "level",
-			EncodeLevel: zapcore.CapitalLevelEncoder,
-			TimeKey:     "time",
-			EncodeTime:  zapcore.ISO8601TimeEncoder,
-		},
+		GuestCluster:        guestCluster,
+		GuestInputResources: discoverGuestClusterInputResources(),
+
+		OperatorNameFunc: dynamiccache.OperatorNameFromLabel(config.OperatorNameLabel),
+		EventBufferSize:  config.EventBufferSize,
+		ReconcileDelay:   config.ReconcileDelay,
+
+		ServeOperatorSnapshots: config.DebugOperatorsEndpoint,
+
+		MaxConcurrentReconciles: config.MaxConcurrentReconciles,
+		FullResyncInterval:      config.FullResyncInterval,
+		ReconcileBaseDelay:      config.ReconcileBaseDelay,
+		ReconcileMaxDelay:       config.ReconcileMaxDelay,
+
+		InformerStartupConcurrency: config.InformerStartupConcurrency,
+		PerObjectRate:              config.PerObjectRate,
+		PerObjectBurst:             config.PerObjectBurst,
+		TolerantPartialSync:        config.TolerantPartialSync,
+		MaxCachedObjectsPerGVK:     config.MaxCachedObjectsPerGVK,
+		EventHandlerStagger:        config.EventHandlerStagger,
+
+		MetadataOnlyExact:    config.MetadataOnlyExact,
+		TrackStatusKinds:     dynamiccache.GroupKindsFor(config.TrackStatusKinds),
+		FallbackToLiveClient: config.FallbackToLiveClient,
+		OutputDir:            config.OutputDir,
+		CacheObjectMode:      config.CacheObjectMode,
+		UnstructuredFallback: config.UnstructuredFallback,
 	}
-	return cfg.Build()
-}
 
-type Config struct {
-	LogLevel   string
-	LogEncoder string
-}
+	if config.OperatorKind != "" {
+		gvk, _ := schema.ParseKindArg(config.OperatorKind)
+		reconciler.OperatorWatch = &dynamiccache.OperatorWatch{
+			GVK:            *gvk,
+			InputResources: dynamiccache.InputResourcesFromField(config.OperatorInputResourcesField),
+		}
+	}
+	if config.AuditEvents {
+		reconciler.AuditLog = logrLogger.WithName("audit")
+	}
+	if config.EmitEvents {
+		reconciler.Recorder = mgr.GetEventRecorderFor("controller-runtime-dynamic-cache")
+	}
 
-// ParseConfiguration fills the 'OperatorConfig' from the flags passed to the program
-func parseConfiguration(fs *flag.FlagSet, args []string) (Config, error) {
-	config := Config{}
-	fs.StringVar(&config.LogLevel, "log-level", "info", "Log level. Available values: debug | info | warn | error | dpanic | panic | fatal or a numeric value from -9 to 5, where -9 is the most verbose and 5 is the least verbose.")
-	fs.StringVar(&config.LogEncoder, "log-encoder", "json", "Log encoder. Available values: json | console")
+	ctx := ctrl.SetupSignalHandler()
+	if config.OTLPEndpoint != "" {
+		tracerProvider, err := dynamiccache.NewOTLPTracerProvider(ctx, config.OTLPEndpoint)
+		if err != nil {
+			os.Exit(1)
+		}
+		defer tracerProvider.Shutdown(context.Background())
+		reconciler.TracerProvider = tracerProvider
+	}
 
-	if err := fs.Parse(args); err != nil {
-		return Config{}, fmt.Errorf("failed to parse arguments: %w", err)
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		os.Exit(1)
+	}
+	if err := mgr.Add(dynamiccache.NewInputResourceReloader(dynamiccache.InputResourceReloaderOptions{
+		Log:    ctrl.Log.WithName("input-resource-reloader"),
+		Load:   loadInputResources,
+		Reload: reconciler.Reload,
+	})); err != nil {
+		os.Exit(1)
 	}
 
-	return config, nil
+	if err := mgr.Start(ctx); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,428 @@
+package dynamiccache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// Builder wires the input resources declared on a cluster to a controller:
+// it creates the initializer observing them, feeds the events of its dispatcher to the controller
+// through a channel source, and registers the initializer, its readiness checks and debug handler with the manager.
+// The readiness checks pass on standby replicas, which don't sync the input resources until they are elected leader.
+//
+// By default, the controller reconciles one request per operator, named after the operator, see WithMapFunc.
+// Objects are mapped to the operators whose input resources match them,
+// or to the operators returned by the OperatorNameFunc otherwise.
+// Deleted objects are dispatched as DeletedObject, see WithDeletedObjectTracking.
+type Builder struct {
+	mgr            ctrl.Manager
+	name           string
+	log            logr.Logger
+	controller     controller.Controller
+	clusterName    string
+	cluster        cluster.Cluster
+	isolated       bool
+	scheme         *runtime.Scheme
+	addToSchemes   []func(*runtime.Scheme) error
+	inputResources map[string]*libraryinputresources.InputResources
+	refinements    map[string]*InputResourceRefinements
+	operatorNames  OperatorNameFunc
+	bufferSize     int
+	objectOptions  ObjectOptions
+	audit          AuditFunc
+	trackDeleted   bool
+	mapFunc        handler.MapFunc
+
+	informerStartupConcurrency int
+	perObjectRate              float64
+	perObjectBurst             int
+	tolerantPartialSync        bool
+	maxCachedObjectsPerGVK     int
+	eventHandlerStagger        time.Duration
+	rateLimiter                workqueue.TypedRateLimiter[reconcile.Request]
+	maxConcurrentReconciles    int
+	operatorWatch              *OperatorWatch
+	restrictedCache            bool
+	onOperatorRemoved          func(operator string)
+}
+
+// NewBuilder returns a builder observing the input resources on the manager's cluster.
+func NewBuilder(mgr ctrl.Manager) *Builder {
+	return &Builder{
+		mgr:           mgr,
+		name:          "dynamic-cache",
+		log:           ctrl.Log.WithName("dynamic-cache"),
+		clusterName:   managementClusterName,
+		cluster:       mgr,
+		operatorNames: OperatorNameFromLabel(DefaultOperatorNameLabel),
+	}
+}
+
+// Named sets the name of the controller created by Build, it is ignored when WithController is used.
+func (b *Builder) Named(name string) *Builder {
+	b.name = name
+	return b
+}
+
+// WithLogger sets the logger of the initializer.
+func (b *Builder) WithLogger(log logr.Logger) *Builder {
+	b.log = log
+	return b
+}
+
+// WithController adds the cluster's events to an existing controller instead of creating one,
+// so that a single controller can observe several clusters.
+func (b *Builder) WithController(c controller.Controller) *Builder {
+	b.controller = c
+	return b
+}
+
+// WithCluster observes the input resources on another cluster than the manager's.
+// The cluster must have been added to the manager. The name tells the clusters apart in the logs,
+// readiness checks and debug handlers.
+func (b *Builder) WithCluster(name string, c cluster.Cluster) *Builder {
+	b.clusterName = name
+	b.cluster = c
+	return b
+}
+
+// WithIsolation makes a failure to sync the input resources be retried instead of stopping the manager,
+// and the controller not wait for the cluster to sync before it starts.
+func (b *Builder) WithIsolation(isolated bool) *Builder {
+	b.isolated = isolated
+	return b
+}
+
+// WithScheme sets the scheme the objects are created from, defaults to the cluster's scheme.
+func (b *Builder) WithScheme(scheme *runtime.Scheme) *Builder {
+	b.scheme = scheme
+	return b
+}
+
+// WithAddToSchemes registers more types into the scheme when building, e.g. the API groups of an embedder,
+// so that their kinds are read and watched as typed objects. Kinds missing from the scheme are still read
+// as unstructured objects when the UnstructuredFallback is enabled.
+func (b *Builder) WithAddToSchemes(addToSchemes ...func(*runtime.Scheme) error) *Builder {
+	b.addToSchemes = append(b.addToSchemes, addToSchemes...)
+	return b
+}
+
+// WithInputResources sets the input resources to observe, keyed by the operator name.
+func (b *Builder) WithInputResources(inputResources map[string]*libraryinputresources.InputResources) *Builder {
+	b.inputResources = inputResources
+	return b
+}
+
+// WithInputResourceRefinements narrows down what the input resources match, keyed by the operator name,
+// see InputResourceRefinements.
+func (b *Builder) WithInputResourceRefinements(refinements map[string]*InputResourceRefinements) *Builder {
+	b.refinements = refinements
+	return b
+}
+
+// WithOperatorNameFunc sets the function returning the operators an object belongs to,
+// it is used for the objects that weren't declared as exact resources.
+// Defaults to OperatorNameFromLabel with the DefaultOperatorNameLabel.
+func (b *Builder) WithOperatorNameFunc(f OperatorNameFunc) *Builder {
+	b.operatorNames = f
+	return b
+}
+
+// WithBufferSize sets the number of events buffered between the informers and the controller,
+// defaults to DefaultEventBufferSize.
+func (b *Builder) WithBufferSize(n int) *Builder {
+	b.bufferSize = n
+	return b
+}
+
+// WithObjectOptions sets which objects are used to read and watch the input resources.
+func (b *Builder) WithObjectOptions(opts ObjectOptions) *Builder {
+	b.objectOptions = opts
+	return b
+}
+
+// WithAudit sets the callback called for every dispatched event, see EventDispatcherOptions.
+func (b *Builder) WithAudit(audit AuditFunc) *Builder {
+	b.audit = audit
+	return b
+}
+
+// WithMapFunc replaces the default mapping of the dispatched objects to one request per operator,
+// e.g. to reconcile the input resources themselves. Deleted objects are passed as DeletedObject.
+// The OperatorNameFunc and WithDeletedObjectTracking are only used by the default mapping.
+func (b *Builder) WithMapFunc(f handler.MapFunc) *Builder {
+	b.mapFunc = f
+	return b
+}
+
+// WithDeletedObjectTracking makes the initializer keep the last known state of the deleted objects for the operators
+// they were mapped to, until they are taken by the reconciler. Only the DynamicReconciler takes them.
+func (b *Builder) WithDeletedObjectTracking(track bool) *Builder {
+	b.trackDeleted = track
+	return b
+}
+
+// WithInformerStartupConcurrency sets the number of informers registered at once while syncing,
+// defaults to DefaultInformerStartupConcurrency.
+func (b *Builder) WithInformerStartupConcurrency(n int) *Builder {
+	b.informerStartupConcurrency = n
+	return b
+}
+
+// WithPerObjectRateLimit limits the events dispatched per object to perSecond, with bursts of up to burst events.
+// Events over the limit are coalesced to the latest one, see EventDispatcherOptions. A zero rate disables the limit.
+func (b *Builder) WithPerObjectRateLimit(perSecond float64, burst int) *Builder {
+	b.perObjectRate = perSecond
+	b.perObjectBurst = burst
+	return b
+}
+
+// WithPartialSyncTolerance makes the sync complete without the informers that don't sync in time instead of failing,
+// see InputResourceInitializerOptions.TolerantPartialSync. The informers-synced readiness check reports them until they sync.
+func (b *Builder) WithPartialSyncTolerance(tolerate bool) *Builder {
+	b.tolerantPartialSync = tolerate
+	return b
+}
+
+// WithMaxCachedObjectsPerGVK fails the initial sync when the informer of a kind holds more than n objects,
+// see InputResourceInitializerOptions.MaxCachedObjectsPerGVK. Zero disables the limit.
+func (b *Builder) WithMaxCachedObjectsPerGVK(n int) *Builder {
+	b.maxCachedObjectsPerGVK = n
+	return b
+}
+
+// WithEventHandlerStagger delays adding the event handler of every informer by a random duration of up to d,
+// to spread out the replay of the informers syncing at once, see InputResourceInitializerOptions.EventHandlerStagger.
+func (b *Builder) WithEventHandlerStagger(d time.Duration) *Builder {
+	b.eventHandlerStagger = d
+	return b
+}
+
+// WithRateLimiter sets the rate limiter of the workqueue of the controller created by Build,
+// defaults to the controller-runtime default. It is ignored when WithController is used.
+func (b *Builder) WithRateLimiter(rateLimiter workqueue.TypedRateLimiter[reconcile.Request]) *Builder {
+	b.rateLimiter = rateLimiter
+	return b
+}
+
+// WithMaxConcurrentReconciles sets the number of requests the controller created by Build reconciles in parallel,
+// defaults to 1. It is ignored when WithController is used.
+func (b *Builder) WithMaxConcurrentReconciles(n int) *Builder {
+	b.maxConcurrentReconciles = n
+	return b
+}
+
+// WithOperatorWatch makes the initializer add, change and remove operators along the CRs representing them,
+// see InputResourceInitializerOptions.OperatorWatch. Nil disables it.
+func (b *Builder) WithOperatorWatch(watch *OperatorWatch) *Builder {
+	b.operatorWatch = watch
+	return b
+}
+
+// WithRestrictedCache tells that the cache of the cluster is restricted to the input resources with InputResourceCacheOptions,
+// operators added later are rejected when the restriction hides their input resources. See InputResourceInitializerOptions.RestrictedCache.
+func (b *Builder) WithRestrictedCache(restricted bool) *Builder {
+	b.restrictedCache = restricted
+	return b
+}
+
+// WithOperatorRemovedFunc sets the callback called once an operator has been removed,
+// see InputResourceInitializerOptions.OnOperatorRemoved.
+func (b *Builder) WithOperatorRemovedFunc(f func(operator string)) *Builder {
+	b.onOperatorRemoved = f
+	return b
+}
+
+// Complete builds the controller and registers everything with the manager.
+func (b *Builder) Complete(r reconcile.Reconciler) error {
+	_, err := b.Build(r)
+	return err
+}
+
+// Build is like Complete, but also returns the initializer observing the cluster,
+// e.g. to add and remove operators later on. The reconciler is ignored when WithController is used.
+func (b *Builder) Build(r reconcile.Reconciler) (*InputResourceInitializer, error) {
+	if err := b.validate(r); err != nil {
+		return nil, err
+	}
+	scheme := b.scheme
+	if scheme == nil {
+		scheme = b.cluster.GetScheme()
+	}
+	for _, addToScheme := range b.addToSchemes {
+		if err := addToScheme(scheme); err != nil {
+			return nil, fmt.Errorf("failed to register types into the scheme: %w", err)
+		}
+	}
+	bufferSize := b.bufferSize
+	if bufferSize == 0 {
+		bufferSize = DefaultEventBufferSize
+	}
+	operatorNamesFor := b.operatorNames
+	trackDeleted := b.trackDeleted
+
+	c := b.controller
+	if c == nil {
+		var err error
+		c, err = controller.New(b.name, b.mgr, controller.Options{Reconciler: r, RateLimiter: b.rateLimiter, MaxConcurrentReconciles: b.maxConcurrentReconciles})
+		if err != nil {
+			return nil, err
+		}
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfigAndClient(b.cluster.GetConfig(), b.cluster.GetHTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	initializer := NewInputResourceInitializer(InputResourceInitializerOptions{
+		Log: b.log,
+		Cluster: InputResourceCluster{
+			Name:           b.clusterName,
+			Cache:          b.cluster.GetCache(),
+			Mapper:         b.cluster.GetRESTMapper(),
+			APIReader:      b.cluster.GetAPIReader(),
+			InputResources: b.inputResources,
+			Refinements:    b.refinements,
+			Isolated:       b.isolated,
+		},
+		Discovery:       discoveryClient,
+		Scheme:          scheme,
+		ObjectOptions:   b.objectOptions,
+		EventBufferSize: bufferSize,
+		Audit:           b.audit,
+
+		InformerStartupConcurrency: b.informerStartupConcurrency,
+		PerObjectRate:              b.perObjectRate,
+		PerObjectBurst:             b.perObjectBurst,
+		TolerantPartialSync:        b.tolerantPartialSync,
+		MaxCachedObjectsPerGVK:     b.maxCachedObjectsPerGVK,
+		EventHandlerStagger:        b.eventHandlerStagger,
+		OperatorWatch:              b.operatorWatch,
+		RestrictedCache:            b.restrictedCache,
+		OnOperatorRemoved:          b.onOperatorRemoved,
+	})
+	mapFunc := b.mapFunc
+	if mapFunc == nil {
+		mapFunc = defaultMapFunc(initializer, scheme, operatorNamesFor, trackDeleted)
+	}
+	channelSource := source.Channel(initializer.dispatcher.Events(), handler.EnqueueRequestsFromMapFunc(mapFunc), source.WithBufferSize[client.Object, reconcile.Request](bufferSize))
+	watchedSource := source.TypedSource[reconcile.Request](&syncingChannelSource{source: channelSource, synced: initializer.Synced(), syncErr: initializer.syncErr})
+	if b.isolated {
+		watchedSource = channelSource
+	}
+	if err := c.Watch(watchedSource); err != nil {
+		return nil, err
+	}
+	if err := b.mgr.AddMetricsServerExtraHandler(clusterScopedName("/debug/watches", b.clusterName), watchesHandler(initializer)); err != nil {
+		return nil, err
+	}
+	if err := b.mgr.AddReadyzCheck(clusterScopedName("input-resources-synced", b.clusterName), electedOnlyCheck(b.mgr.Elected(), syncedCheck(initializer))); err != nil {
+		return nil, err
+	}
+	if err := b.mgr.AddReadyzCheck(clusterScopedName("informers-synced", b.clusterName), electedOnlyCheck(b.mgr.Elected(), informersSyncedCheck(initializer))); err != nil {
+		return nil, err
+	}
+	if err := b.mgr.Add(initializer); err != nil {
+		return nil, err
+	}
+	return initializer, nil
+}
+
+// defaultMapFunc maps the dispatched objects to one request per operator whose filters match them,
+// or per operator returned by operatorNamesFor when none does anymore, e.g. because the filters changed since the dispatch.
+// Resyncs are mapped to the operator they are for.
+func defaultMapFunc(initializer *InputResourceInitializer, scheme *runtime.Scheme, operatorNamesFor OperatorNameFunc, trackDeleted bool) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		if resync, ok := obj.(*ResyncObject); ok {
+			return []reconcile.Request{requestForOperator(operatorIdentity{Namespace: resync.GetNamespace(), Name: resync.GetName()}, obj)}
+		}
+		obj, deleted := unwrapDeletedObject(obj)
+		// the dispatcher sets the GVK of every object it forwards, the scheme is only asked for objects of other sources
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if gvk.Empty() {
+			gvk, _ = apiutil.GVKForObject(obj, scheme)
+		}
+		operatorNames := initializer.dispatcher.MatchingOperators(gvk, obj)
+		if len(operatorNames) == 0 {
+			operatorNames = operatorNamesFor(obj)
+		}
+		if deleted && trackDeleted {
+			initializer.recordDeletedObject(operatorNames, gvk, obj)
+		}
+		requests := make([]reconcile.Request, 0, len(operatorNames))
+		for _, operatorName := range operatorNames {
+			requests = append(requests, requestForOperator(operatorIdentityFor(operatorName), obj))
+		}
+		return requests
+	}
+}
+
+// validate reports all missing or invalid settings at once.
+func (b *Builder) validate(r reconcile.Reconciler) error {
+	if b.mgr == nil {
+		return fmt.Errorf("a manager is required")
+	}
+	var errs []error
+	if b.cluster == nil {
+		errs = append(errs, fmt.Errorf("cluster %q is nil", b.clusterName))
+	}
+	if b.clusterName == "" {
+		errs = append(errs, fmt.Errorf("the cluster name must not be empty"))
+	}
+	if b.scheme == nil && b.cluster != nil && b.cluster.GetScheme() == nil {
+		errs = append(errs, fmt.Errorf("a scheme is required, the cluster %q doesn't have one, see WithScheme", b.clusterName))
+	}
+	if b.inputResources == nil {
+		errs = append(errs, fmt.Errorf("input resources are required, see WithInputResources"))
+	}
+	if b.operatorNames == nil && b.mapFunc == nil {
+		errs = append(errs, fmt.Errorf("an operator name function is required, see WithOperatorNameFunc"))
+	}
+	if b.operatorWatch != nil && (b.operatorWatch.GVK.Version == "" || b.operatorWatch.GVK.Kind == "") {
+		errs = append(errs, fmt.Errorf("the operator watch requires the version and kind of the operator CRs, got %q", b.operatorWatch.GVK.String()))
+	}
+	if b.bufferSize < 0 {
+		errs = append(errs, fmt.Errorf("the buffer size must not be negative, got %d", b.bufferSize))
+	}
+	if b.informerStartupConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("the informer startup concurrency must not be negative, got %d", b.informerStartupConcurrency))
+	}
+	if b.perObjectRate < 0 {
+		errs = append(errs, fmt.Errorf("the per object rate must not be negative, got %v", b.perObjectRate))
+	}
+	if b.perObjectBurst < 0 {
+		errs = append(errs, fmt.Errorf("the per object burst must not be negative, got %d", b.perObjectBurst))
+	}
+	if b.maxCachedObjectsPerGVK < 0 {
+		errs = append(errs, fmt.Errorf("the maximum number of cached objects per kind must not be negative, got %d", b.maxCachedObjectsPerGVK))
+	}
+	if b.maxConcurrentReconciles < 0 {
+		errs = append(errs, fmt.Errorf("the maximum number of concurrent reconciles must not be negative, got %d", b.maxConcurrentReconciles))
+	}
+	if b.eventHandlerStagger < 0 {
+		errs = append(errs, fmt.Errorf("the event handler stagger must not be negative, got %v", b.eventHandlerStagger))
+	}
+	if r == nil && b.controller == nil {
+		errs = append(errs, fmt.Errorf("a reconciler is required unless an existing controller is used, see WithController"))
+	}
+	if b.controller == nil && b.name == "" {
+		errs = append(errs, fmt.Errorf("the controller name must not be empty, see Named"))
+	}
+	return utilerrors.NewAggregate(errs)
+}
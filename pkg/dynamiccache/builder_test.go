@@ -0,0 +1,218 @@
+package dynamiccache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDefaultMapFunc(t *testing.T) {
+	i := NewInputResourceInitializer(InputResourceInitializerOptions{
+		Log:     logr.Discard(),
+		Cluster: InputResourceCluster{Name: "cluster", Mapper: testMapper()},
+	})
+	for operator, resources := range map[string]*libraryinputresources.InputResources{
+		"a":     applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "shared"})),
+		"ns/b":  applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "", map[string]string{"app": "shared"})),
+		"c":     applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "other"})),
+		"exact": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "secrets", "ns", "")}),
+	} {
+		filters, err := BuildInputResourceFilters(logr.Discard(), testMapper(), map[string]*libraryinputresources.InputResources{operator: resources}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i.dispatcher.SetFilters(operator, filters)
+	}
+	fallback := func(client.Object) []string { return []string{"fallback"} }
+	mapFunc := defaultMapFunc(i, clientgoscheme.Scheme, fallback, false)
+
+	secret := func(namespace string, labels map[string]string) client.Object {
+		obj := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "secret", Labels: labels}}
+		obj.GetObjectKind().SetGroupVersionKind(secretGVK)
+		return obj
+	}
+	tests := []struct {
+		name string
+		obj  client.Object
+		want []reconcile.Request
+	}{
+		{
+			name: "label-selected object feeding two operators",
+			obj:  secret("ns", map[string]string{"app": "shared"}),
+			want: []reconcile.Request{
+				{NamespacedName: client.ObjectKey{Name: "a"}},
+				{NamespacedName: client.ObjectKey{Name: "exact"}},
+				{NamespacedName: client.ObjectKey{Namespace: "ns", Name: "b"}},
+			},
+		},
+		{
+			name: "deleted label-selected object",
+			obj:  &DeletedObject{Object: secret("other", map[string]string{"app": "shared"})},
+			want: []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: "ns", Name: "b"}}},
+		},
+		{
+			name: "exact resource without a name",
+			obj:  secret("ns", nil),
+			want: []reconcile.Request{{NamespacedName: client.ObjectKey{Name: "exact"}}},
+		},
+		{
+			name: "object no filter matches",
+			obj:  secret("other", nil),
+			want: []reconcile.Request{{NamespacedName: client.ObjectKey{Name: "fallback"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mapFunc(context.Background(), test.obj); !equality.Semantic.DeepEqual(got, test.want) {
+				t.Errorf("expected the requests %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+// heldLock is a lease held by another replica for an hour, the manager using it stays a standby.
+type heldLock struct{}
+
+func (heldLock) Get(_ context.Context) (*resourcelock.LeaderElectionRecord, []byte, error) {
+	record := &resourcelock.LeaderElectionRecord{
+		HolderIdentity:       "leader",
+		LeaseDurationSeconds: 3600,
+		AcquireTime:          metav1.Now(),
+		RenewTime:            metav1.Now(),
+	}
+	raw, err := json.Marshal(record)
+	return record, raw, err
+}
+
+func (heldLock) Create(_ context.Context, _ resourcelock.LeaderElectionRecord) error { return nil }
+func (heldLock) Update(_ context.Context, _ resourcelock.LeaderElectionRecord) error { return nil }
+func (heldLock) RecordEvent(string)                                                  {}
+func (heldLock) Identity() string                                                    { return "standby" }
+func (heldLock) Describe() string                                                    { return "held lock" }
+
+// idleCache is a synced cache without objects, the manager can start it.
+type idleCache struct {
+	cache.Cache
+}
+
+func (idleCache) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (idleCache) WaitForCacheSync(_ context.Context) bool {
+	return true
+}
+
+// checkRecordingManager records the readiness checks added to the manager.
+type checkRecordingManager struct {
+	manager.Manager
+	checks map[string]healthz.Checker
+}
+
+func (m *checkRecordingManager) AddReadyzCheck(name string, check healthz.Checker) error {
+	m.checks[name] = check
+	return m.Manager.AddReadyzCheck(name, check)
+}
+
+func TestBuildOnStandby(t *testing.T) {
+	mgr, err := manager.New(&rest.Config{Host: "https://localhost:6443"}, manager.Options{
+		Scheme:                              clientgoscheme.Scheme,
+		LeaderElection:                      true,
+		LeaderElectionResourceLockInterface: heldLock{},
+		Metrics:                             metricsserver.Options{BindAddress: "0"},
+		Controller:                          config.Controller{SkipNameValidation: ptr.To(true)},
+		MapperProvider: func(*rest.Config, *http.Client) (meta.RESTMapper, error) {
+			return testMapper(), nil
+		},
+		NewCache: func(*rest.Config, cache.Options) (cache.Cache, error) {
+			return idleCache{}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recording := &checkRecordingManager{Manager: mgr, checks: map[string]healthz.Checker{}}
+	initializer, err := NewBuilder(recording).
+		WithLogger(logr.Discard()).
+		WithInputResources(map[string]*libraryinputresources.InputResources{
+			"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "config")}),
+		}).
+		Build(reconcile.Func(func(context.Context, reconcile.Request) (reconcile.Result, error) {
+			return reconcile.Result{}, nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the initializer would sync right away if it was started
+	initializer.syncDelay = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Start(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("unexpected error from the manager: %v", err)
+		}
+	}()
+	// gives the manager the time to start the runnables it would start on the leader too
+	time.Sleep(500 * time.Millisecond)
+
+	select {
+	case <-mgr.Elected():
+		t.Fatal("expected the manager to be a standby")
+	default:
+	}
+	if initializer.HasSynced() {
+		t.Error("expected the standby not to sync the input resources")
+	}
+	if events := len(initializer.dispatcher.Events()); events != 0 {
+		t.Errorf("expected the standby not to dispatch events, got %d", events)
+	}
+	if len(recording.checks) != 2 {
+		t.Fatalf("expected two readiness checks, got %v", recording.checks)
+	}
+	for name, check := range recording.checks {
+		if err := check(nil); err != nil {
+			t.Errorf("expected the readiness check %s to pass on the standby, got %v", name, err)
+		}
+	}
+}
+
+func TestElectedOnlyCheck(t *testing.T) {
+	elected := make(chan struct{})
+	errNotSynced := errors.New("not synced")
+	check := electedOnlyCheck(elected, func(*http.Request) error { return errNotSynced })
+
+	if err := check(nil); err != nil {
+		t.Errorf("expected the check to pass before the election, got %v", err)
+	}
+	close(elected)
+	if err := check(nil); !errors.Is(err, errNotSynced) {
+		t.Errorf("expected the error of the check once elected, got %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package dynamiccache
+
+import (
+	"fmt"
+	"strings"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// cacheSelection is what an input resource selects from the objects of its kind.
+type cacheSelection struct {
+	namespace string
+	// name is set for exact resources
+	name string
+	// labelSelector is set for label selected resources
+	labelSelector string
+}
+
+// InputResourceCacheOptions restricts the informer of every kind referenced by the input resources
+// to the namespaces, names and label selectors the input resources declare,
+// so that the cache doesn't fetch objects no filter would ever match.
+//
+// When every resource of a kind declares a namespace, the informer is restricted to those namespaces.
+// Within a namespace, or cluster-wide otherwise, the informer is further restricted to a single
+// name with a field selector, or to a single label selector, when all resources agree on it.
+// A field selector can't match several names, so several names widen the restriction to the namespace.
+//
+// The restriction is set on the cache once, at startup. Operators added afterwards, see InputResourceInitializerOptions.RestrictedCache,
+// are rejected when their input resources fall outside of it.
+func InputResourceCacheOptions(mapper meta.RESTMapper, scheme *runtime.Scheme, opts ObjectOptions, inputResources map[string]*libraryinputresources.InputResources) (map[client.Object]cache.ByObject, error) {
+	restrictions, err := cacheRestrictionsFor(mapper, scheme, opts, inputResources)
+	if err != nil {
+		return nil, err
+	}
+	byObject := map[client.Object]cache.ByObject{}
+	for gvk, restriction := range restrictions {
+		obj, err := newObjectFor(scheme, gvk, opts)
+		if err != nil {
+			return nil, err
+		}
+		byObject[obj] = restriction
+	}
+	return byObject, nil
+}
+
+// cacheRestrictionsFor returns the restriction of the informer of every kind that can be restricted, see InputResourceCacheOptions.
+func cacheRestrictionsFor(mapper meta.RESTMapper, scheme *runtime.Scheme, opts ObjectOptions, inputResources map[string]*libraryinputresources.InputResources) (map[schema.GroupVersionKind]cache.ByObject, error) {
+	selectionsByKind := map[schema.GroupVersionKind][]cacheSelection{}
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		for _, resources := range resourceListsOf(inputResources[operator]) {
+			for _, def := range resources.ExactResources {
+				gvk, err := mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+				if err != nil {
+					return nil, fmt.Errorf("operator %q: unable to resolve %s exact resource %s: %w", operator, resources.category, gvrFor(def.InputResourceTypeIdentifier), err)
+				}
+				selectionsByKind[gvk] = append(selectionsByKind[gvk], cacheSelection{namespace: def.Namespace, name: def.Name})
+			}
+			for _, def := range resources.LabelSelectedResources {
+				gvk, err := mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+				if err != nil {
+					return nil, fmt.Errorf("operator %q: unable to resolve %s label selected resource %s: %w", operator, resources.category, gvrFor(def.InputResourceTypeIdentifier), err)
+				}
+				selector, err := metav1.LabelSelectorAsSelector(&def.LabelSelector)
+				if err != nil {
+					return nil, fmt.Errorf("operator %q: invalid label selector for %s %s: %w", operator, resources.category, gvrFor(def.InputResourceTypeIdentifier), err)
+				}
+				selectionsByKind[gvk] = append(selectionsByKind[gvk], cacheSelection{namespace: def.Namespace, labelSelector: selector.String()})
+			}
+		}
+	}
+
+	restrictions := map[schema.GroupVersionKind]cache.ByObject{}
+	for gvk, selections := range selectionsByKind {
+		if _, err := newObjectFor(scheme, gvk, opts); err != nil {
+			continue
+		}
+
+		selectionsByNamespace := map[string][]cacheSelection{}
+		for _, selection := range selections {
+			selectionsByNamespace[selection.namespace] = append(selectionsByNamespace[selection.namespace], selection)
+		}
+		if _, ok := selectionsByNamespace[""]; ok {
+			config, err := cacheConfigFor(selections)
+			if err != nil {
+				return nil, err
+			}
+			if config.LabelSelector != nil || config.FieldSelector != nil {
+				restrictions[gvk] = cache.ByObject{Label: config.LabelSelector, Field: config.FieldSelector}
+			}
+			continue
+		}
+
+		namespaces := map[string]cache.Config{}
+		for namespace, namespaceSelections := range selectionsByNamespace {
+			config, err := cacheConfigFor(namespaceSelections)
+			if err != nil {
+				return nil, err
+			}
+			namespaces[namespace] = config
+		}
+		restrictions[gvk] = cache.ByObject{Namespaces: namespaces}
+	}
+	return restrictions, nil
+}
+
+// checkCacheRestrictions ensures that the input resources of an operator added after startup are all visible
+// through the cache restricted to the startup input resources, see InputResourceCacheOptions.
+// An input resource is visible when adding it to the startup input resources wouldn't widen the restriction of its kind.
+// All hidden kinds are reported at once.
+func checkCacheRestrictions(mapper meta.RESTMapper, scheme *runtime.Scheme, opts ObjectOptions, startup map[string]*libraryinputresources.InputResources, operator string, resources *libraryinputresources.InputResources) error {
+	restricted, err := cacheRestrictionsFor(mapper, scheme, opts, startup)
+	if err != nil {
+		return err
+	}
+	if len(restricted) == 0 {
+		return nil
+	}
+	// the resources are added next to the startup ones rather than replacing a startup operator of the same name,
+	// so that an operator reloaded with fewer input resources doesn't narrow the restriction it is compared with
+	required, err := cacheRestrictionsFor(mapper, scheme, opts, withOperator(startup, operator+" (added)", resources))
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for gvk, restriction := range restricted {
+		if describeCacheRestriction(required[gvk]) != describeCacheRestriction(restriction) {
+			errs = append(errs, fmt.Errorf("operator %q: the cache of %s is restricted to %s by the input resources observed at startup, a restart is required to observe the new input resources", operator, gvk, describeCacheRestriction(restriction)))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// describeCacheRestriction formats a restriction of the cache deterministically, so that two restrictions can be compared.
+func describeCacheRestriction(restriction cache.ByObject) string {
+	describe := func(label labels.Selector, field fields.Selector) string {
+		var description []string
+		if label != nil {
+			description = append(description, "labels "+label.String())
+		}
+		if field != nil {
+			description = append(description, "fields "+field.String())
+		}
+		if len(description) == 0 {
+			return "all objects"
+		}
+		return strings.Join(description, ", ")
+	}
+
+	if len(restriction.Namespaces) == 0 {
+		return describe(restriction.Label, restriction.Field)
+	}
+	var namespaces []string
+	for _, namespace := range sets.List(sets.KeySet(restriction.Namespaces)) {
+		config := restriction.Namespaces[namespace]
+		namespaces = append(namespaces, fmt.Sprintf("%s in namespace %q", describe(config.LabelSelector, config.FieldSelector), namespace))
+	}
+	return strings.Join(namespaces, "; ")
+}
+
+// cacheConfigFor returns the narrowest config matching all the selections,
+// a single name or a single label selector shared by all of them, or no restriction otherwise.
+func cacheConfigFor(selections []cacheSelection) (cache.Config, error) {
+	names := sets.New[string]()
+	labelSelectors := sets.New[string]()
+	for _, selection := range selections {
+		if selection.labelSelector != "" {
+			labelSelectors.Insert(selection.labelSelector)
+			continue
+		}
+		if selection.name == "" {
+			// an exact resource without a name matches all objects
+			return cache.Config{}, nil
+		}
+		names.Insert(selection.name)
+	}
+
+	switch {
+	case names.Len() == 1 && labelSelectors.Len() == 0:
+		return cache.Config{FieldSelector: fields.OneTermEqualSelector("metadata.name", names.UnsortedList()[0])}, nil
+	case names.Len() == 0 && labelSelectors.Len() == 1:
+		selector, err := labels.Parse(labelSelectors.UnsortedList()[0])
+		if err != nil {
+			return cache.Config{}, err
+		}
+		return cache.Config{LabelSelector: selector}, nil
+	default:
+		return cache.Config{}, nil
+	}
+}
+
+// DefaultNamespacesFor restricts the cache to the given namespaces, an empty list means all namespaces.
+func DefaultNamespacesFor(namespaces []string) map[string]cache.Config {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	defaultNamespaces := map[string]cache.Config{}
+	for _, namespace := range namespaces {
+		defaultNamespaces[namespace] = cache.Config{}
+	}
+	return defaultNamespaces
+}
+
+// ValidateInputResourceNamespaces ensures that the input resources only reference namespaces the cache is restricted to.
+func ValidateInputResourceNamespaces(namespaces []string, inputResources map[string]*libraryinputresources.InputResources) error {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	allowed := sets.New[string](namespaces...)
+
+	var errs []error
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		for _, resources := range resourceListsOf(inputResources[operator]) {
+			for _, def := range resources.ExactResources {
+				if def.Namespace != "" && !allowed.Has(def.Namespace) {
+					errs = append(errs, fmt.Errorf("operator %q: %s exact resource %s %s/%s is outside of the watched namespaces %v", operator, resources.category, gvrFor(def.InputResourceTypeIdentifier), def.Namespace, def.Name, sets.List(allowed)))
+				}
+			}
+			for _, def := range resources.LabelSelectedResources {
+				if def.Namespace != "" && !allowed.Has(def.Namespace) {
+					errs = append(errs, fmt.Errorf("operator %q: %s label selected resource %s in namespace %q is outside of the watched namespaces %v", operator, resources.category, gvrFor(def.InputResourceTypeIdentifier), def.Namespace, sets.List(allowed)))
+				}
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,86 @@
+package dynamiccache
+
+import (
+	"strings"
+	"testing"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestCheckCacheRestrictions(t *testing.T) {
+	startup := map[string]*libraryinputresources.InputResources{
+		"a": applyConfigurationResources(
+			[]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "config")},
+			labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "a"}),
+		),
+	}
+
+	tests := []struct {
+		name      string
+		operator  string
+		resources *libraryinputresources.InputResources
+		wantErrs  []string
+	}{
+		{
+			name:      "same exact resource",
+			operator:  "b",
+			resources: applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "config")}),
+		},
+		{
+			name:      "same label selector",
+			operator:  "b",
+			resources: applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "a"})),
+		},
+		{
+			name:      "kind not restricted at startup",
+			operator:  "b",
+			resources: applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("apps", "v1", "deployments", "other", "deployment")}),
+		},
+		{
+			name:      "reloaded operator with fewer resources",
+			operator:  "a",
+			resources: applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "config")}),
+		},
+		{
+			name:      "other name",
+			operator:  "b",
+			resources: applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "other")}),
+			wantErrs:  []string{`operator "b": the cache of /v1, Kind=ConfigMap is restricted to fields metadata.name=config in namespace "ns"`},
+		},
+		{
+			name:      "other namespace",
+			operator:  "b",
+			resources: applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "other", map[string]string{"app": "a"})),
+			wantErrs:  []string{`operator "b": the cache of /v1, Kind=Secret is restricted to labels app=a in namespace "ns"`},
+		},
+		{
+			name:     "all hidden kinds are reported",
+			operator: "b",
+			resources: applyConfigurationResources(
+				[]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "", "config")},
+				labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "b"}),
+			),
+			wantErrs: []string{"Kind=ConfigMap is restricted", "Kind=Secret is restricted"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCacheRestrictions(testMapper(), clientgoscheme.Scheme, ObjectOptions{}, startup, tt.operator, tt.resources)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tt.wantErrs)
+			}
+			for _, wantErr := range tt.wantErrs {
+				if !strings.Contains(err.Error(), wantErr) {
+					t.Errorf("expected the error to contain %q, got %v", wantErr, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package dynamiccache
+
+import (
+	"net/http"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+)
+
+const (
+	managementClusterName = "management"
+	guestClusterName      = "guest"
+)
+
+// InputResourceCluster is a cluster the operators declare input resources on.
+type InputResourceCluster struct {
+	Name      string
+	Cache     cache.Cache
+	Mapper    meta.RESTMapper
+	APIReader client.Reader
+	// InputResources are keyed by the operator name
+	InputResources map[string]*libraryinputresources.InputResources
+	// Refinements narrow down what the input resources match, keyed by the operator name.
+	// They apply to the operators added later on too, see InputResourceRefinements.
+	Refinements map[string]*InputResourceRefinements
+	// Isolated clusters don't hold up the controller until they synced,
+	// a failure to sync their input resources is retried instead of stopping the manager.
+	Isolated bool
+}
+
+// clusterScopedName returns the name as is for the management cluster and suffixed with the cluster name otherwise,
+// so that the paths and checks of the management cluster keep their names.
+func clusterScopedName(name, cluster string) string {
+	if cluster == managementClusterName {
+		return name
+	}
+	return name + "-" + cluster
+}
+
+// GuestClusterOptions configures the guest cluster created by NewGuestCluster.
+type GuestClusterOptions struct {
+	// Kubeconfig is the path to the kubeconfig of the guest cluster.
+	Kubeconfig string
+	// RESTConfig, when set, connects to the guest cluster instead of the Kubeconfig.
+	RESTConfig *rest.Config
+	Scheme     *runtime.Scheme
+	// CacheOptions are extended with the restrictions derived from the InputResources.
+	CacheOptions  cache.Options
+	ObjectOptions ObjectOptions
+	// InputResources are the input resources the operators declare on the guest cluster, keyed by the operator name.
+	InputResources map[string]*libraryinputresources.InputResources
+	// MapperOptions configure the RESTMapper of the guest cluster, see NewRefreshingRESTMapper.
+	MapperOptions RefreshingRESTMapperOptions
+}
+
+// NewGuestCluster creates the guest cluster from the kubeconfig, or the REST config when set,
+// its cache is restricted to the guest cluster input resources like the management cluster's.
+func NewGuestCluster(opts GuestClusterOptions) (cluster.Cluster, error) {
+	restConfig := opts.RESTConfig
+	if restConfig == nil {
+		var err error
+		restConfig, err = clientcmd.BuildConfigFromFlags("", opts.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfigAndClient(restConfig, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	mapper := NewRefreshingRESTMapper(discoveryClient, opts.MapperOptions)
+	cacheOptions := opts.CacheOptions
+	cacheOptions.ByObject, err = InputResourceCacheOptions(mapper, opts.Scheme, opts.ObjectOptions, opts.InputResources)
+	if err != nil {
+		return nil, err
+	}
+
+	return cluster.New(restConfig, func(o *cluster.Options) {
+		o.Scheme = opts.Scheme
+		o.HTTPClient = httpClient
+		o.MapperProvider = func(*rest.Config, *http.Client) (meta.RESTMapper, error) {
+			return mapper, nil
+		}
+		o.Cache = cacheOptions
+	})
+}
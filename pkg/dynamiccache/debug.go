@@ -0,0 +1,145 @@
+package dynamiccache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// WatchDescription describes the informer of a GVK, the operators referencing it and what their filters match.
+// It is the schema of the JSON output format, fields are only ever added to it.
+type WatchDescription struct {
+	// GVK is the GVK as formatted by schema.GroupVersionKind.String, Group, Version and Kind are its parts.
+	GVK     string `json:"gvk"`
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Scope is either Namespaced or Cluster, it is empty when the GVK can no longer be resolved.
+	Scope     string                   `json:"scope,omitempty"`
+	Operators []string                 `json:"operators"`
+	Filters   []OperatorFilterCriteria `json:"filters"`
+}
+
+// OperatorFilterCriteria is what a filter of an operator matches.
+type OperatorFilterCriteria struct {
+	Operator string `json:"operator"`
+	EventFilterCriteria
+}
+
+// describeWatch describes the watch of the GVK by the operators, using their filter criteria.
+func describeWatch(mapper meta.RESTMapper, gvk schema.GroupVersionKind, operators []string, criteria map[string]map[schema.GroupVersionKind][]EventFilterCriteria) WatchDescription {
+	watch := WatchDescription{
+		GVK:       gvk.String(),
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Kind:      gvk.Kind,
+		Operators: operators,
+		Filters:   []OperatorFilterCriteria{},
+	}
+	if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		watch.Scope = scopeDescription(mapping.Scope.Name())
+	}
+	for _, operator := range operators {
+		for _, c := range criteria[operator][gvk] {
+			watch.Filters = append(watch.Filters, OperatorFilterCriteria{Operator: operator, EventFilterCriteria: c})
+		}
+	}
+	return watch
+}
+
+func scopeDescription(scope meta.RESTScopeName) string {
+	if scope == meta.RESTScopeNameRoot {
+		return "Cluster"
+	}
+	return "Namespaced"
+}
+
+// OutputFormat selects how watches are written.
+type OutputFormat string
+
+const (
+	// JSONOutputFormat writes the watches as a JSON array of WatchDescription.
+	JSONOutputFormat OutputFormat = "json"
+	// TableOutputFormat writes a row per filter with aligned columns, for humans.
+	TableOutputFormat OutputFormat = "table"
+)
+
+// writeWatches writes the watches sorted by GVK in the format, an empty format means JSON.
+func writeWatches(w io.Writer, watches []WatchDescription, format OutputFormat) error {
+	sort.Slice(watches, func(i, j int) bool { return watches[i].GVK < watches[j].GVK })
+	switch format {
+	case JSONOutputFormat, "":
+		return json.NewEncoder(w).Encode(watches)
+	case TableOutputFormat:
+		return writeWatchesTable(w, watches)
+	default:
+		return fmt.Errorf("unsupported output format %q, available formats: %s | %s", format, JSONOutputFormat, TableOutputFormat)
+	}
+}
+
+// writeWatchesTable writes a row per filter of every watch, "*" stands for all namespaces or names.
+func writeWatchesTable(w io.Writer, watches []WatchDescription) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tGROUP\tVERSION\tKIND\tSCOPE\tNAMESPACE\tNAME/SELECTOR")
+	for _, watch := range watches {
+		group := watch.Group
+		if group == "" {
+			group = "core"
+		}
+		for _, filter := range watch.Filters {
+			namespace := "*"
+			switch {
+			case filter.Namespace != "":
+				namespace = filter.Namespace
+			case len(filter.Namespaces) > 0:
+				namespace = strings.Join(filter.Namespaces, ",")
+			}
+			nameOrSelector := "*"
+			switch {
+			case filter.Name != "":
+				nameOrSelector = filter.Name
+			case len(filter.Names) > 0:
+				nameOrSelector = strings.Join(filter.Names, ",")
+			case filter.LabelSelector != "":
+				nameOrSelector = filter.LabelSelector
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", filter.Operator, group, watch.Version, watch.Kind, watch.Scope, namespace, nameOrSelector)
+		}
+	}
+	return tw.Flush()
+}
+
+// watchesHandler serves the GVKs with a registered informer,
+// together with the operators referencing them and what their filters match.
+// They are served as JSON, or in the format of the output query parameter, e.g. ?output=table.
+func watchesHandler(initializer *InputResourceInitializer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		criteria := initializer.dispatcher.FilterCriteria()
+
+		watches := []WatchDescription{}
+		for _, gvk := range initializer.informers.GVKs() {
+			watches = append(watches, describeWatch(initializer.cluster.Mapper, gvk, initializer.informers.Operators(gvk), criteria))
+		}
+
+		format := OutputFormat(r.URL.Query().Get("output"))
+		var buf bytes.Buffer
+		if err := writeWatches(&buf, watches, format); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if format == TableOutputFormat {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,119 @@
+package dynamiccache
+
+import (
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type observedResourceKey struct {
+	cluster   string
+	operator  string
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+type observedResource struct {
+	resourceVersion string
+	content         map[string]interface{}
+}
+
+// observedResources remembers the last observed state of the input resources per operator,
+// so that successive observations can be diffed.
+// It is safe for concurrent use since reconciles can overlap.
+type observedResources struct {
+	lock    sync.Mutex
+	objects map[observedResourceKey]observedResource
+}
+
+// Observe records the object and returns the difference to its previous observation by the operator on the cluster.
+// The diff is empty for the first observation and when only the resourceVersion or managedFields changed.
+// The values of Secrets are redacted from the diff, only the keys whose value changed are told apart.
+// The previous resourceVersion is empty for the first observation.
+func (o *observedResources) Observe(cluster, operator string, obj *unstructured.Unstructured) (diff string, previousResourceVersion string) {
+	key := observedResourceKey{cluster: cluster, operator: operator, gvk: obj.GroupVersionKind(), namespace: obj.GetNamespace(), name: obj.GetName()}
+	current := observedResource{resourceVersion: obj.GetResourceVersion(), content: diffableContent(obj)}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.objects == nil {
+		o.objects = map[observedResourceKey]observedResource{}
+	}
+	previous, ok := o.objects[key]
+	o.objects[key] = current
+	if !ok {
+		return "", ""
+	}
+	if isSecret(key.gvk) {
+		previousContent, currentContent := redactSecretChanges(previous.content, current.content)
+		return cmp.Diff(previousContent, currentContent), previous.resourceVersion
+	}
+	return cmp.Diff(previous.content, current.content), previous.resourceVersion
+}
+
+// LastResourceVersion returns the resourceVersion of the last observation of the object by the operator,
+// or an empty string when it hasn't been observed yet.
+func (o *observedResources) LastResourceVersion(cluster, operator string, gvk schema.GroupVersionKind, key client.ObjectKey) string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.objects[observedResourceKey{cluster: cluster, operator: operator, gvk: gvk, namespace: key.Namespace, name: key.Name}].resourceVersion
+}
+
+// Forget drops the last observation of the object by the operator, e.g. once the object has been deleted.
+func (o *observedResources) Forget(cluster, operator string, gvk schema.GroupVersionKind, key client.ObjectKey) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	delete(o.objects, observedResourceKey{cluster: cluster, operator: operator, gvk: gvk, namespace: key.Namespace, name: key.Name})
+}
+
+// ForgetOperator drops the observations of the operator on the cluster, once the operator is no longer observed there.
+func (o *observedResources) ForgetOperator(cluster, operator string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for key := range o.objects {
+		if key.cluster == cluster && key.operator == operator {
+			delete(o.objects, key)
+		}
+	}
+}
+
+// diffableContent returns a copy of the object without the fields that change on every write.
+func diffableContent(obj *unstructured.Unstructured) map[string]interface{} {
+	content := obj.DeepCopy().Object
+	unstructured.RemoveNestedField(content, "metadata", "resourceVersion")
+	unstructured.RemoveNestedField(content, "metadata", "managedFields")
+	return content
+}
+
+// redactedChangedValue replaces a value of a Secret that changed between two observations.
+const redactedChangedValue = "<redacted, changed>"
+
+// redactSecretChanges returns copies of two observations of a Secret whose values are redacted,
+// so that the diff only tells which keys were added, removed or changed, never their values.
+func redactSecretChanges(previous, current map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	previous, current = runtime.DeepCopyJSON(previous), runtime.DeepCopyJSON(current)
+	for _, field := range secretDataFields {
+		previousValues, _ := previous[field].(map[string]interface{})
+		currentValues, _ := current[field].(map[string]interface{})
+		for key, value := range currentValues {
+			if previousValue, ok := previousValues[key]; ok && !cmp.Equal(previousValue, value) {
+				currentValues[key] = redactedChangedValue
+				continue
+			}
+			currentValues[key] = redactedValue
+		}
+		for key := range previousValues {
+			previousValues[key] = redactedValue
+		}
+	}
+	return previous, current
+}
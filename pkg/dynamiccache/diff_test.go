@@ -0,0 +1,73 @@
+package dynamiccache
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func unstructuredObject(gvk schema.GroupVersionKind, namespace, name, resourceVersion string, fields map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: fields}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetResourceVersion(resourceVersion)
+	return obj
+}
+
+func TestObserveRedactsSecrets(t *testing.T) {
+	var observed observedResources
+	observed.Observe("cluster", "a", unstructuredObject(secretGVK, "ns", "secret", "1", map[string]interface{}{
+		"data":       map[string]interface{}{"kept": "a2VwdA==", "changed": "b2xk", "removed": "Z29uZQ=="},
+		"stringData": map[string]interface{}{"password": "old-password"},
+	}))
+	diff, previousResourceVersion := observed.Observe("cluster", "a", unstructuredObject(secretGVK, "ns", "secret", "2", map[string]interface{}{
+		"data":       map[string]interface{}{"kept": "a2VwdA==", "changed": "bmV3", "added": "YWRkZWQ="},
+		"stringData": map[string]interface{}{"password": "new-password"},
+	}))
+	if previousResourceVersion != "1" {
+		t.Errorf("expected previous resourceVersion 1, got %q", previousResourceVersion)
+	}
+	for _, value := range []string{"a2VwdA==", "b2xk", "bmV3", "Z29uZQ==", "YWRkZWQ=", "old-password", "new-password"} {
+		if strings.Contains(diff, value) {
+			t.Errorf("expected the diff not to contain the value %q:\n%s", value, diff)
+		}
+	}
+	for _, key := range []string{`"changed"`, `"removed"`, `"added"`, `"password"`, redactedChangedValue} {
+		if !strings.Contains(diff, key) {
+			t.Errorf("expected the diff to contain %s:\n%s", key, diff)
+		}
+	}
+}
+
+func TestObserveDiffsConfigMaps(t *testing.T) {
+	var observed observedResources
+	observed.Observe("cluster", "a", unstructuredObject(configMapGVK, "ns", "config", "1", map[string]interface{}{"data": map[string]interface{}{"key": "old"}}))
+	diff, _ := observed.Observe("cluster", "a", unstructuredObject(configMapGVK, "ns", "config", "2", map[string]interface{}{"data": map[string]interface{}{"key": "new"}}))
+	if !strings.Contains(diff, "old") || !strings.Contains(diff, "new") {
+		t.Errorf("expected the diff to contain the values of the configmap:\n%s", diff)
+	}
+}
+
+func TestForgetOperator(t *testing.T) {
+	var observed observedResources
+	for _, operator := range []string{"a", "b"} {
+		observed.Observe("cluster", operator, unstructuredObject(configMapGVK, "ns", "config", "1", map[string]interface{}{}))
+		observed.Observe("other", operator, unstructuredObject(configMapGVK, "ns", "config", "1", map[string]interface{}{}))
+	}
+
+	observed.ForgetOperator("cluster", "a")
+
+	key := client.ObjectKey{Namespace: "ns", Name: "config"}
+	if rv := observed.LastResourceVersion("cluster", "a", configMapGVK, key); rv != "" {
+		t.Errorf("expected the observations of the removed operator to be forgotten, got resourceVersion %q", rv)
+	}
+	for _, remaining := range []struct{ cluster, operator string }{{"cluster", "b"}, {"other", "a"}, {"other", "b"}} {
+		if rv := observed.LastResourceVersion(remaining.cluster, remaining.operator, configMapGVK, key); rv != "1" {
+			t.Errorf("expected the observation of operator %q on cluster %q to be kept, got resourceVersion %q", remaining.operator, remaining.cluster, rv)
+		}
+	}
+}
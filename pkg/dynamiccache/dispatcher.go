@@ -0,0 +1,441 @@
+package dynamiccache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// syncingChannelSource is synced once the synced channel has been closed,
+// an error received from syncErr is returned by WaitForSync as the reason the sync failed.
+type syncingChannelSource struct {
+	source  source.Source
+	synced  <-chan struct{}
+	syncErr <-chan error
+}
+
+var _ source.SyncingSource = (*syncingChannelSource)(nil)
+
+func (s *syncingChannelSource) Start(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+	return s.source.Start(ctx, queue)
+}
+
+func (s *syncingChannelSource) WaitForSync(ctx context.Context) error {
+	select {
+	case <-s.synced:
+		return nil
+	case err := <-s.syncErr:
+		return fmt.Errorf("failed to sync the input resources: %w", err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// syncedCheck is a readiness check passing once the initial sync of the initializer completed,
+// until then it reports the operators that haven't synced yet.
+func syncedCheck(initializer *InputResourceInitializer) healthz.Checker {
+	return func(_ *http.Request) error {
+		if initializer.HasSynced() {
+			return nil
+		}
+		if unsynced := initializer.UnsyncedOperators(); len(unsynced) > 0 {
+			return fmt.Errorf("input resources of the operators %v have not been synced yet", unsynced)
+		}
+		return fmt.Errorf("input resources have not been synced yet")
+	}
+}
+
+// electedOnlyCheck passes the check on standby replicas until the elected channel is closed,
+// the initializers only start syncing once the replica is elected leader, see InputResourceInitializer.NeedLeaderElection.
+func electedOnlyCheck(elected <-chan struct{}, check healthz.Checker) healthz.Checker {
+	return func(req *http.Request) error {
+		select {
+		case <-elected:
+			return check(req)
+		default:
+			return nil
+		}
+	}
+}
+
+// informersSyncedCheck is a readiness check passing while all registered informers have synced,
+// it refreshes the informer synced gauge every time it runs.
+func informersSyncedCheck(initializer *InputResourceInitializer) healthz.Checker {
+	return func(_ *http.Request) error {
+		if unsynced := initializer.UnsyncedInformers(); len(unsynced) > 0 {
+			return fmt.Errorf("informers of %v have not synced", unsynced)
+		}
+		return nil
+	}
+}
+
+// EventDispatcher sends the objects observed by the informers to the controller,
+// when they match the filters of at least one operator.
+type EventDispatcher struct {
+	log    logr.Logger
+	events chan event.GenericEvent
+
+	// lock guards the filters, it is held while an event is sent,
+	// so that no event passes the filters of an operator once RemoveFilters returns.
+	lock    sync.RWMutex
+	filters map[string]map[schema.GroupVersionKind][]EventFilter
+	// publishedFilters is a copy of the filters swapped on every change, read by MatchingOperators without the lock,
+	// since the controller maps the events while a sender may hold the lock waiting for room in the buffer
+	publishedFilters atomic.Pointer[map[string]map[schema.GroupVersionKind][]EventFilter]
+
+	// done is closed by Stop and Close, events handled afterwards are dropped
+	done      chan struct{}
+	stopOnce  sync.Once
+	closeOnce sync.Once
+
+	// audit, when set, is called inline for every dispatched event with the operators whose filters matched it
+	audit AuditFunc
+
+	// objectLimiter, when set, limits the rate of the events dispatched per object
+	objectLimiter *objectRateLimiter
+}
+
+// DefaultEventBufferSize is the number of events buffered by a dispatcher when no size is given.
+const DefaultEventBufferSize = 1024
+
+// AuditFunc is called with every dispatched event and the operators whose filters matched it.
+type AuditFunc func(gvk schema.GroupVersionKind, obj client.Object, operators []string)
+
+// EventDispatcherOptions configures an EventDispatcher.
+type EventDispatcherOptions struct {
+	// Log reports the events of kinds no operator has filters for, at V(4).
+	Log logr.Logger
+	// BufferSize is the number of events buffered between the informers and the controller,
+	// defaults to DefaultEventBufferSize.
+	BufferSize int
+	// Audit, when set, is called inline for every dispatched event,
+	// it must be cheap since it runs on the informer's goroutine.
+	Audit AuditFunc
+	// PerObjectRate is the number of events per second dispatched for a single object, zero disables the limit.
+	// Events over the limit are coalesced, only the latest one is dispatched once the object is allowed again.
+	PerObjectRate float64
+	// PerObjectBurst is the number of events dispatched for a single object at once before PerObjectRate applies,
+	// defaults to 1.
+	PerObjectBurst int
+}
+
+// NewEventDispatcher creates a dispatcher buffering up to opts.BufferSize events.
+// Events are never dropped until the dispatcher is stopped or closed: once the buffer is full, Handle blocks
+// and with it the informer delivering the event, until the controller catches up.
+// A larger buffer absorbs bigger bursts at the cost of memory held by the queued objects.
+func NewEventDispatcher(opts EventDispatcherOptions) *EventDispatcher {
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultEventBufferSize
+	}
+	d := &EventDispatcher{
+		log:     opts.Log,
+		events:  make(chan event.GenericEvent, bufferSize),
+		filters: map[string]map[schema.GroupVersionKind][]EventFilter{},
+		done:    make(chan struct{}),
+		audit:   opts.Audit,
+	}
+	d.publishFilters()
+	if opts.PerObjectRate > 0 {
+		d.objectLimiter = newObjectRateLimiter(opts.PerObjectRate, opts.PerObjectBurst, d.sendHeldBack)
+	}
+	return d
+}
+
+// Events returns the channel the dispatched events are sent to, it is closed by Close.
+func (d *EventDispatcher) Events() <-chan event.GenericEvent {
+	return d.events
+}
+
+// SetFilters replaces the filters of the operator.
+// It is safe to call while informers are delivering events.
+func (d *EventDispatcher) SetFilters(operator string, filters map[schema.GroupVersionKind][]EventFilter) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.filters[operator] = filters
+	d.publishFilters()
+}
+
+// FilterCriteria returns what the filters of every operator match, grouped by GVK.
+func (d *EventDispatcher) FilterCriteria() map[string]map[schema.GroupVersionKind][]EventFilterCriteria {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	criteria := map[string]map[schema.GroupVersionKind][]EventFilterCriteria{}
+	for operator, operatorFilters := range d.filters {
+		criteria[operator] = map[schema.GroupVersionKind][]EventFilterCriteria{}
+		for gvk, filters := range operatorFilters {
+			for _, filter := range filters {
+				criteria[operator][gvk] = append(criteria[operator][gvk], filter.Criteria)
+			}
+		}
+	}
+	return criteria
+}
+
+// RemoveFilters removes the filters of the operator.
+// It waits for events that already passed them to be sent.
+func (d *EventDispatcher) RemoveFilters(operator string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.filters, operator)
+	d.publishFilters()
+}
+
+// publishFilters swaps the published copy of the filters, it must be called with the lock held.
+func (d *EventDispatcher) publishFilters() {
+	published := make(map[string]map[schema.GroupVersionKind][]EventFilter, len(d.filters))
+	for operator, operatorFilters := range d.filters {
+		published[operator] = operatorFilters
+	}
+	d.publishedFilters.Store(&published)
+}
+
+// MatchingOperators returns the sorted names of the operators whose filters match the object, e.g. to map a dispatched event.
+// It doesn't wait for the events being sent, so it is safe to call from the controller reading them.
+func (d *EventDispatcher) MatchingOperators(gvk schema.GroupVersionKind, obj client.Object) []string {
+	return operatorsMatching(*d.publishedFilters.Load(), gvk, obj)
+}
+
+// Handle sends a copy of the object to the controller when it matches the filters of any operator.
+// The object is passed as delivered by the informer, tombstones of deleted objects are unwrapped here,
+// so that the event handlers don't need to. A tombstone is dispatched as a DeletedObject.
+func (d *EventDispatcher) Handle(gvk schema.GroupVersionKind, obj interface{}) {
+	_, isTombstone := obj.(toolscache.DeletedFinalStateUnknown)
+	d.dispatch(gvk, obj, isTombstone)
+}
+
+// HandleDelete is like Handle, but dispatches the object as a DeletedObject,
+// so that the controller learns the last known state of the deleted object.
+func (d *EventDispatcher) HandleDelete(gvk schema.GroupVersionKind, obj interface{}) {
+	d.dispatch(gvk, obj, true)
+}
+
+func (d *EventDispatcher) dispatch(gvk schema.GroupVersionKind, obj interface{}, deleted bool) {
+	cobj, ok := clientObjectFromEvent(obj)
+	if !ok {
+		droppedEventsTotal.WithLabelValues(gvk.String()).Inc()
+		return
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	select {
+	case <-d.done:
+		droppedEventsTotal.WithLabelValues(gvk.String()).Inc()
+		return
+	default:
+	}
+	if !d.hasFilters(gvk) {
+		// the informer delivering the event should only exist while an operator has filters for its kind
+		unfilteredEventsTotal.WithLabelValues(gvk.String()).Inc()
+		d.log.V(4).Info("no operator has filters for the kind of the event, the informers and filters are out of sync", "gvk", gvk.String(), "object", client.ObjectKeyFromObject(cobj).String())
+		return
+	}
+	if !d.matches(gvk, cobj) {
+		filteredEventsTotal.WithLabelValues(gvk.String()).Inc()
+		return
+	}
+	// the object is owned by the informer's store, hand out a copy so that the
+	// controller never reads it concurrently with the informer updating it.
+	// Only matching objects are copied, filtered out events don't pay for it.
+	dispatched := cobj.DeepCopyObject().(client.Object)
+	// typed objects lose their TypeMeta when decoded by the informers, set the GVK the informer was registered for
+	// so that the controller and the map func don't have to guess it
+	dispatched.GetObjectKind().SetGroupVersionKind(gvk)
+	if deleted {
+		dispatched = &DeletedObject{Object: dispatched}
+	}
+	if d.objectLimiter != nil && !d.objectLimiter.Allow(gvk, cobj, dispatched) {
+		return
+	}
+	d.send(gvk, dispatched)
+}
+
+// sendHeldBack sends an event the rate limiter held back, unless it no longer matches any filter.
+func (d *EventDispatcher) sendHeldBack(gvk schema.GroupVersionKind, dispatched client.Object) {
+	cobj, _ := unwrapDeletedObject(dispatched)
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	select {
+	case <-d.done:
+		droppedEventsTotal.WithLabelValues(gvk.String()).Inc()
+		return
+	default:
+	}
+	if !d.matches(gvk, cobj) {
+		filteredEventsTotal.WithLabelValues(gvk.String()).Inc()
+		return
+	}
+	d.send(gvk, dispatched)
+}
+
+// send sends a matching event to the controller, it must be called with the lock held for reading.
+func (d *EventDispatcher) send(gvk schema.GroupVersionKind, dispatched client.Object) {
+	cobj, _ := unwrapDeletedObject(dispatched)
+	operators := d.matchingOperators(gvk, cobj)
+	if d.audit != nil {
+		d.audit(gvk, cobj, operators)
+	}
+	categories := d.matchingCategories(gvk, cobj)
+	select {
+	case d.events <- event.GenericEvent{Object: dispatched}:
+		dispatchedEventsTotal.WithLabelValues(gvk.String()).Inc()
+		for _, category := range categories {
+			matchedEventsTotal.WithLabelValues(gvk.String(), category).Inc()
+		}
+		for _, operator := range operators {
+			operatorLastEventTimestampSeconds.WithLabelValues(operator).SetToCurrentTime()
+		}
+	case <-d.done:
+		droppedEventsTotal.WithLabelValues(gvk.String()).Inc()
+	}
+}
+
+// Stop stops dispatching new events, the senders waiting for room in the buffer return right away and drop their event.
+// The buffered events are left for the controller, the events channel is only closed by Close.
+// It is safe to call several times and concurrently with Handle.
+func (d *EventDispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.done)
+	})
+}
+
+// Close stops dispatching new events, drops the events held back by the per-object rate limit
+// and closes the events channel. The buffered events are left for the controller, a closed channel is still read until empty.
+// It returns the number of events left in the buffer and the number of held back events dropped.
+func (d *EventDispatcher) Close() (buffered, dropped int) {
+	d.closeOnce.Do(func() {
+		// unblocks the senders waiting for room in the buffer
+		d.Stop()
+		// waits for the in-flight sends
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		if d.objectLimiter != nil {
+			dropped = d.objectLimiter.dropPending()
+		}
+		buffered = len(d.events)
+		close(d.events)
+	})
+	return buffered, dropped
+}
+
+// hasFilters reports whether any operator has filters for the GVK, regardless of whether they match.
+func (d *EventDispatcher) hasFilters(gvk schema.GroupVersionKind) bool {
+	for _, operatorFilters := range d.filters {
+		if len(operatorFilters[gvk]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *EventDispatcher) matches(gvk schema.GroupVersionKind, obj client.Object) bool {
+	for _, operatorFilters := range d.filters {
+		for _, filter := range operatorFilters[gvk] {
+			if filter.Matches(obj) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchingOperators returns the sorted names of the operators whose filters match the object,
+// it must be called with the lock held.
+func (d *EventDispatcher) matchingOperators(gvk schema.GroupVersionKind, obj client.Object) []string {
+	return operatorsMatching(d.filters, gvk, obj)
+}
+
+func operatorsMatching(filters map[string]map[schema.GroupVersionKind][]EventFilter, gvk schema.GroupVersionKind, obj client.Object) []string {
+	var operators []string
+	for operator, operatorFilters := range filters {
+		for _, filter := range operatorFilters[gvk] {
+			if filter.Matches(obj) {
+				operators = append(operators, operator)
+				break
+			}
+		}
+	}
+	sort.Strings(operators)
+	return operators
+}
+
+// matchingCategories returns the sorted categories of the filters matching the object.
+func (d *EventDispatcher) matchingCategories(gvk schema.GroupVersionKind, obj client.Object) []string {
+	categories := sets.New[string]()
+	for _, operatorFilters := range d.filters {
+		for _, filter := range operatorFilters[gvk] {
+			if !categories.Has(filter.Criteria.Category) && filter.Matches(obj) {
+				categories.Insert(filter.Criteria.Category)
+			}
+		}
+	}
+	return sets.List(categories)
+}
+
+// auditLogger returns an audit callback logging every dispatched event to the logger.
+func auditLogger(log logr.Logger) AuditFunc {
+	return func(gvk schema.GroupVersionKind, obj client.Object, operators []string) {
+		log.Info("dispatched event",
+			"gvk", gvk.String(),
+			"namespace", obj.GetNamespace(),
+			"name", obj.GetName(),
+			"resourceVersion", obj.GetResourceVersion(),
+			"operators", operators,
+		)
+	}
+}
+
+// clientObjectFromEvent returns the object of an informer event,
+// the last known state of the object for a toolscache.DeletedFinalStateUnknown tombstone.
+func clientObjectFromEvent(obj interface{}) (client.Object, bool) {
+	if cobj, ok := obj.(client.Object); ok {
+		return cobj, true
+	}
+	tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown)
+	if !ok {
+		return nil, false
+	}
+	cobj, ok := tombstone.Obj.(client.Object)
+	return cobj, ok
+}
+
+// DeletedObject marks an object dispatched because it was deleted,
+// the wrapped object is its last known state, e.g. the object of a tombstone.
+type DeletedObject struct {
+	client.Object
+}
+
+// DeepCopyObject keeps the deletion marker on the copy.
+func (d *DeletedObject) DeepCopyObject() runtime.Object {
+	return &DeletedObject{Object: d.Object.DeepCopyObject().(client.Object)}
+}
+
+// unwrapDeletedObject returns the last known state of a DeletedObject, other objects are returned as they are.
+func unwrapDeletedObject(obj client.Object) (client.Object, bool) {
+	if deleted, ok := obj.(*DeletedObject); ok {
+		return deleted.Object, true
+	}
+	return obj, false
+}
@@ -0,0 +1,40 @@
+package dynamiccache
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestEventDispatcherCloseTwice(t *testing.T) {
+	d := NewEventDispatcher(EventDispatcherOptions{Log: logr.Discard(), BufferSize: 2})
+	d.SetFilters("a", map[schema.GroupVersionKind][]EventFilter{
+		configMapGVK: {exactResourceFilter(applyConfigurationCategory, sets.New("ns"), sets.New("config"), "", nil)},
+	})
+	d.Handle(configMapGVK, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"}})
+
+	if buffered, dropped := d.Close(); buffered != 1 || dropped != 0 {
+		t.Errorf("expected 1 buffered event and none dropped, got %d buffered and %d dropped", buffered, dropped)
+	}
+	// closing the events channel twice would panic
+	if buffered, dropped := d.Close(); buffered != 0 || dropped != 0 {
+		t.Errorf("expected the second close to be a no-op, got %d buffered and %d dropped", buffered, dropped)
+	}
+	d.Stop()
+
+	// the events handled once closed are dropped rather than sent to the closed channel
+	d.Handle(configMapGVK, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "config"}})
+	d.Resync("a")
+
+	var events int
+	for range d.Events() {
+		events++
+	}
+	if events != 1 {
+		t.Errorf("expected only the event buffered before the close, got %d events", events)
+	}
+}
@@ -0,0 +1,6 @@
+// Package dynamiccache observes the input resources declared by operators through a controller-runtime cache.
+//
+// An InputResourceInitializer registers the informers for the kinds the input resources reference,
+// their events pass through the EventFilters of an EventDispatcher and the matching objects
+// are handed to the DynamicReconciler through a channel source.
+package dynamiccache
@@ -0,0 +1,78 @@
+package dynamiccache
+
+import (
+	"io"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+)
+
+// PlanWatchesOptions configures PlanWatches.
+type PlanWatchesOptions struct {
+	Log logr.Logger
+	// Discovery verifies that the cluster serves the input resources.
+	Discovery discovery.DiscoveryInterface
+	Mapper    meta.RESTMapper
+	// InputResources are keyed by the operator name.
+	InputResources map[string]*libraryinputresources.InputResources
+	// Refinements are keyed by the operator name, see InputResourceRefinements.
+	Refinements map[string]*InputResourceRefinements
+}
+
+// PlanWatches validates and resolves the input resources the way an InputResourceInitializer does before it starts the informers,
+// and returns the watches it would register. Nothing is watched, only discovery and the RESTMapper are queried.
+// All validation failures are returned together.
+func PlanWatches(opts PlanWatchesOptions) ([]WatchDescription, error) {
+	if err := validateInputResources(opts.InputResources, opts.Refinements); err != nil {
+		return nil, err
+	}
+	if err := checkSupportedInputResources(opts.Discovery, opts.InputResources); err != nil {
+		return nil, err
+	}
+
+	// the filters are built per operator, the resources shared by several operators are reported here
+	reportSharedExactResources(opts.Log, opts.InputResources)
+	var errs []error
+	criteria := map[string]map[schema.GroupVersionKind][]EventFilterCriteria{}
+	operatorsByGVK := map[schema.GroupVersionKind]sets.Set[string]{}
+	for _, operator := range sets.List(sets.KeySet(opts.InputResources)) {
+		filters, err := BuildInputResourceFilters(opts.Log, opts.Mapper, map[string]*libraryinputresources.InputResources{operator: opts.InputResources[operator]}, opts.Refinements)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		criteria[operator] = map[schema.GroupVersionKind][]EventFilterCriteria{}
+		for gvk, gvkFilters := range filters {
+			if _, ok := operatorsByGVK[gvk]; !ok {
+				operatorsByGVK[gvk] = sets.New[string]()
+			}
+			operatorsByGVK[gvk].Insert(operator)
+			for _, filter := range gvkFilters {
+				criteria[operator][gvk] = append(criteria[operator][gvk], filter.Criteria)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+
+	watches := []WatchDescription{}
+	for gvk, operators := range operatorsByGVK {
+		watches = append(watches, describeWatch(opts.Mapper, gvk, sets.List(operators), criteria))
+	}
+	return watches, nil
+}
+
+// DryRun writes the watches PlanWatches returns in the format, like the /debug/watches endpoint does.
+func DryRun(w io.Writer, format OutputFormat, opts PlanWatchesOptions) error {
+	watches, err := PlanWatches(opts)
+	if err != nil {
+		return err
+	}
+	return writeWatches(w, watches, format)
+}
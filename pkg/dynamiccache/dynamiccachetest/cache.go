@@ -0,0 +1,233 @@
+package dynamiccachetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+type cacheKey struct {
+	gvk schema.GroupVersionKind
+	key client.ObjectKey
+}
+
+// Cache is an in-memory cache.Cache preloaded with objects, to run DynamicReconciler.Reconcile without a cluster.
+// It only serves reads: the objects are returned as typed, unstructured or metadata only objects,
+// whatever the reader asks for, and missing objects are reported as NotFound.
+// It has no informers, getting one returns an error.
+// A Cache is safe for concurrent use.
+type Cache struct {
+	scheme *runtime.Scheme
+
+	lock       sync.RWMutex
+	objects    map[cacheKey]map[string]interface{}
+	getErrors  map[cacheKey]error
+	listErrors map[schema.GroupVersionKind]error
+}
+
+var _ cache.Cache = &Cache{}
+
+// NewCache returns a cache holding the objects. The scheme resolves the kinds of typed objects,
+// unstructured objects must have their kind set.
+func NewCache(scheme *runtime.Scheme, objs ...client.Object) (*Cache, error) {
+	c := &Cache{
+		scheme:     scheme,
+		objects:    map[cacheKey]map[string]interface{}{},
+		getErrors:  map[cacheKey]error{},
+		listErrors: map[schema.GroupVersionKind]error{},
+	}
+	for _, obj := range objs {
+		if err := c.Add(obj); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Add adds the object to the cache, replacing the one with the same kind, namespace and name.
+func (c *Cache) Add(obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.objects[cacheKey{gvk: gvk, key: client.ObjectKeyFromObject(obj)}] = u.Object
+	return nil
+}
+
+// Delete removes the object from the cache, reading it afterwards returns NotFound.
+func (c *Cache) Delete(gvk schema.GroupVersionKind, key client.ObjectKey) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.objects, cacheKey{gvk: gvk, key: key})
+}
+
+// InjectGetError makes reading the object return the error, a nil error removes it.
+func (c *Cache) InjectGetError(gvk schema.GroupVersionKind, key client.ObjectKey, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err == nil {
+		delete(c.getErrors, cacheKey{gvk: gvk, key: key})
+		return
+	}
+	c.getErrors[cacheKey{gvk: gvk, key: key}] = err
+}
+
+// InjectListError makes listing the kind return the error, a nil error removes it.
+func (c *Cache) InjectListError(gvk schema.GroupVersionKind, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err == nil {
+		delete(c.listErrors, gvk)
+		return
+	}
+	c.listErrors[gvk] = err
+}
+
+// Get implements client.Reader.
+func (c *Cache) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if err := c.getErrors[cacheKey{gvk: gvk, key: key}]; err != nil {
+		return err
+	}
+	content, ok := c.objects[cacheKey{gvk: gvk, key: key}]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+	return fromUnstructured(content, obj)
+}
+
+// List implements client.Reader, only the namespace and the label selector of the options are honoured.
+func (c *Cache) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listGVK, err := apiutil.GVKForObject(list, c.scheme)
+	if err != nil {
+		return err
+	}
+	gvk := listGVK.GroupVersion().WithKind(strings.TrimSuffix(listGVK.Kind, "List"))
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	selector := listOpts.LabelSelector
+	if selector == nil {
+		selector = labels.Everything()
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if err := c.listErrors[gvk]; err != nil {
+		return err
+	}
+	var items []runtime.Object
+	for k, content := range c.objects {
+		if k.gvk != gvk || (listOpts.Namespace != "" && k.key.Namespace != listOpts.Namespace) {
+			continue
+		}
+		item, err := newItemFor(c.scheme, list, gvk)
+		if err != nil {
+			return err
+		}
+		if err := fromUnstructured(content, item); err != nil {
+			return err
+		}
+		if !selector.Matches(labels.Set(item.GetLabels())) {
+			continue
+		}
+		items = append(items, item)
+	}
+	return meta.SetList(list, items)
+}
+
+// newItemFor returns an empty item of the list, of the same flavour as the list.
+func newItemFor(scheme *runtime.Scheme, list client.ObjectList, gvk schema.GroupVersionKind) (client.Object, error) {
+	var obj runtime.Object
+	switch list.(type) {
+	case *unstructured.UnstructuredList:
+		obj = &unstructured.Unstructured{}
+	case *metav1.PartialObjectMetadataList:
+		obj = &metav1.PartialObjectMetadata{}
+	default:
+		var err error
+		obj, err = scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cobj, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("type %T does not implement client.Object", obj)
+	}
+	cobj.GetObjectKind().SetGroupVersionKind(gvk)
+	return cobj, nil
+}
+
+// fromUnstructured copies the content into the object, the fields the object doesn't have are dropped.
+func fromUnstructured(content map[string]interface{}, obj client.Object) error {
+	content = runtime.DeepCopyJSON(content)
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.SetUnstructuredContent(content)
+		return nil
+	}
+	gvk := obj.GetObjectKind().GroupVersionKind()
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj); err != nil {
+		return err
+	}
+	if !gvk.Empty() {
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	return nil
+}
+
+// GetInformer implements cache.Informers, the cache has no informers.
+func (c *Cache) GetInformer(_ context.Context, obj client.Object, _ ...cache.InformerGetOption) (cache.Informer, error) {
+	return nil, fmt.Errorf("the in-memory cache has no informers")
+}
+
+// GetInformerForKind implements cache.Informers, the cache has no informers.
+func (c *Cache) GetInformerForKind(_ context.Context, _ schema.GroupVersionKind, _ ...cache.InformerGetOption) (cache.Informer, error) {
+	return nil, fmt.Errorf("the in-memory cache has no informers")
+}
+
+// RemoveInformer implements cache.Informers, the cache has no informers.
+func (c *Cache) RemoveInformer(_ context.Context, _ client.Object) error {
+	return nil
+}
+
+// Start implements cache.Informers, it blocks until the context is done.
+func (c *Cache) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+// WaitForCacheSync implements cache.Informers, the cache is always synced.
+func (c *Cache) WaitForCacheSync(_ context.Context) bool {
+	return true
+}
+
+// IndexField implements client.FieldIndexer, the indexes are ignored.
+func (c *Cache) IndexField(_ context.Context, _ client.Object, _ string, _ client.IndexerFunc) error {
+	return nil
+}
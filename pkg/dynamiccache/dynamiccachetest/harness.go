@@ -0,0 +1,122 @@
+// Package dynamiccachetest helps testing the filters and the event dispatching of the dynamiccache package
+// without a cluster or running informers.
+package dynamiccachetest
+
+import (
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+)
+
+// Event is an object dispatched to the controller, with the operators whose filters matched it.
+// The object of a deleted object's event is its last known state.
+type Event struct {
+	GVK       schema.GroupVersionKind
+	Object    client.Object
+	Operators []string
+	Deleted   bool
+}
+
+// Harness feeds objects to an EventDispatcher synchronously, the way an informer would,
+// and returns the events each of them produced.
+// The dispatcher's channel is drained after every object, so it never blocks.
+// A Harness is not safe for concurrent use.
+type Harness struct {
+	dispatcher *dynamiccache.EventDispatcher
+	operators  []string
+}
+
+// NewHarness returns a harness whose dispatcher uses the filters, keyed by the operator name.
+func NewHarness(filters map[string]map[schema.GroupVersionKind][]dynamiccache.EventFilter) *Harness {
+	h := &Harness{}
+	// the channel holds at most the single event of the object being handled, it is drained right after
+	h.dispatcher = dynamiccache.NewEventDispatcher(dynamiccache.EventDispatcherOptions{
+		BufferSize: 1,
+		Audit: func(_ schema.GroupVersionKind, _ client.Object, operators []string) {
+			h.operators = operators
+		},
+	})
+	for operator, operatorFilters := range filters {
+		h.dispatcher.SetFilters(operator, operatorFilters)
+	}
+	return h
+}
+
+// NewHarnessForInputResources returns a harness whose dispatcher uses the filters built from the input resources,
+// like the ones of a running InputResourceInitializer. A meta.DefaultRESTMapper is enough for the mapper.
+func NewHarnessForInputResources(mapper meta.RESTMapper, inputResources map[string]*libraryinputresources.InputResources) (*Harness, error) {
+	return NewHarnessForRefinedInputResources(mapper, inputResources, nil)
+}
+
+// NewHarnessForRefinedInputResources is like NewHarnessForInputResources, with the refinements keyed by the operator name,
+// see dynamiccache.InputResourceRefinements.
+func NewHarnessForRefinedInputResources(mapper meta.RESTMapper, inputResources map[string]*libraryinputresources.InputResources, refinements map[string]*dynamiccache.InputResourceRefinements) (*Harness, error) {
+	filters := map[string]map[schema.GroupVersionKind][]dynamiccache.EventFilter{}
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		operatorFilters, err := dynamiccache.BuildInputResourceFilters(logr.Discard(), mapper, map[string]*libraryinputresources.InputResources{operator: inputResources[operator]}, refinements)
+		if err != nil {
+			return nil, err
+		}
+		filters[operator] = operatorFilters
+	}
+	return NewHarness(filters), nil
+}
+
+// Dispatcher returns the dispatcher of the harness, e.g. to change its filters.
+func (h *Harness) Dispatcher() *dynamiccache.EventDispatcher {
+	return h.dispatcher
+}
+
+// Handle passes the object to the dispatcher and returns the event it produced, if any.
+// The object can be a client.Object or a tombstone, see Tombstone.
+func (h *Harness) Handle(gvk schema.GroupVersionKind, obj interface{}) (Event, bool) {
+	h.operators = nil
+	h.dispatcher.Handle(gvk, obj)
+	return h.next(gvk)
+}
+
+// HandleDelete is like Handle, but passes the object as deleted.
+func (h *Harness) HandleDelete(gvk schema.GroupVersionKind, obj interface{}) (Event, bool) {
+	h.operators = nil
+	h.dispatcher.HandleDelete(gvk, obj)
+	return h.next(gvk)
+}
+
+// next returns the event the last handled object produced, if any.
+func (h *Harness) next(gvk schema.GroupVersionKind) (Event, bool) {
+	select {
+	case e, ok := <-h.dispatcher.Events():
+		if !ok {
+			return Event{}, false
+		}
+		if deleted, ok := e.Object.(*dynamiccache.DeletedObject); ok {
+			return Event{GVK: gvk, Object: deleted.Object, Operators: h.operators, Deleted: true}, true
+		}
+		return Event{GVK: gvk, Object: e.Object, Operators: h.operators}, true
+	default:
+		return Event{}, false
+	}
+}
+
+// HandleAll passes the objects to the dispatcher in order and returns the events they produced.
+func (h *Harness) HandleAll(gvk schema.GroupVersionKind, objs ...interface{}) []Event {
+	var events []Event
+	for _, obj := range objs {
+		if e, ok := h.Handle(gvk, obj); ok {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Tombstone wraps the object the way an informer delivers an object whose deletion it missed.
+func Tombstone(obj client.Object) toolscache.DeletedFinalStateUnknown {
+	key, _ := toolscache.MetaNamespaceKeyFunc(obj)
+	return toolscache.DeletedFinalStateUnknown{Key: key, Obj: obj}
+}
@@ -0,0 +1,36 @@
+package dynamiccache
+
+import (
+	"sync"
+	"time"
+)
+
+// inputResourceEventWindow is the minimum time between two events about the same input resource.
+const inputResourceEventWindow = 30 * time.Second
+
+// eventDeduplicator suppresses events about the same key emitted within inputResourceEventWindow.
+// It is safe for concurrent use.
+type eventDeduplicator struct {
+	lock sync.Mutex
+	last map[string]time.Time
+}
+
+// Allow reports whether an event about the key can be emitted now and records it if so.
+func (d *eventDeduplicator) Allow(key string, now time.Time) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.last == nil {
+		d.last = map[string]time.Time{}
+	}
+	for k, t := range d.last {
+		if now.Sub(t) >= inputResourceEventWindow {
+			delete(d.last, k)
+		}
+	}
+	if _, ok := d.last[key]; ok {
+		return false
+	}
+	d.last[key] = now
+	return true
+}
@@ -0,0 +1,7 @@
+package dynamiccache
+
+// The metrics are exported to the external tests, so that they can assert the metrics moved.
+var (
+	ReconcileDurationSeconds = reconcileDurationSeconds
+	InputResourceReadsTotal  = inputResourceReadsTotal
+)
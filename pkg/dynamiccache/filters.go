@@ -0,0 +1,323 @@
+package dynamiccache
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// EventFilter reports whether an object observed by an informer
+// is one of the input resources declared by an operator.
+type EventFilter struct {
+	// Criteria describes what the filter matches, it is only used for debugging
+	Criteria EventFilterCriteria
+	Matches  func(obj client.Object) bool
+}
+
+type EventFilterCriteria struct {
+	// Category is the resource list of the input resources the filter was built from, e.g. applyConfiguration.
+	Category string `json:"category"`
+	// Namespace is set when the filter matches a single namespace, Namespaces when it matches several.
+	Namespace  string   `json:"namespace,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Name is set when the filter matches a single name, Names when it matches several.
+	Name  string   `json:"name,omitempty"`
+	Names []string `json:"names,omitempty"`
+	// UID is set when the filter only matches the object with the UID, see ExactResource.
+	UID string `json:"uid,omitempty"`
+	// NameRegex is set when the filter only matches the names matching it, see ExactResource.
+	NameRegex     string `json:"nameRegex,omitempty"`
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// Annotation is the annotation the objects must carry, see AnnotationMatch.
+	Annotation string `json:"annotation,omitempty"`
+}
+
+// exactResourceFilter matches the objects in one of the namespaces whose name is one of the names,
+// no namespaces match all namespaces and no names match all names.
+// When the UID is set, only the object with the UID matches, so that an object recreated under the same name doesn't.
+// When the name regex is set, only the objects whose name matches it do.
+func exactResourceFilter(category string, namespaces, names sets.Set[string], uid types.UID, nameRegex *regexp.Regexp) EventFilter {
+	criteria := EventFilterCriteria{Category: category, UID: string(uid)}
+	if nameRegex != nil {
+		criteria.NameRegex = nameRegex.String()
+	}
+	switch namespaces.Len() {
+	case 0:
+	case 1:
+		criteria.Namespace = namespaces.UnsortedList()[0]
+	default:
+		criteria.Namespaces = sets.List(namespaces)
+	}
+	switch names.Len() {
+	case 0:
+	case 1:
+		criteria.Name = names.UnsortedList()[0]
+	default:
+		criteria.Names = sets.List(names)
+	}
+	return EventFilter{
+		Criteria: criteria,
+		Matches: func(obj client.Object) bool {
+			if namespaces.Len() > 0 && !namespaces.Has(obj.GetNamespace()) {
+				return false
+			}
+			if names.Len() > 0 && !names.Has(obj.GetName()) {
+				return false
+			}
+			if nameRegex != nil && !nameRegex.MatchString(obj.GetName()) {
+				return false
+			}
+			return uid == "" || obj.GetUID() == uid
+		},
+	}
+}
+
+// setOfNonEmpty returns a set holding the value, or an empty set for an empty value.
+func setOfNonEmpty(value string) sets.Set[string] {
+	if value == "" {
+		return sets.New[string]()
+	}
+	return sets.New(value)
+}
+
+// exactResourceGroupKey identifies the exact resources of a resource list sharing a kind and a namespace.
+type exactResourceGroupKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+}
+
+// exactResourceGroup collects the names of the exact resources sharing a kind and a namespace,
+// allNames is set once one of them has no name and so matches all names.
+type exactResourceGroup struct {
+	names    sets.Set[string]
+	allNames bool
+}
+
+// exactResourceFilterKey identifies the groups of exact resources sharing a single filter,
+// the ones of the same kind matching the same names.
+type exactResourceFilterKey struct {
+	gvk   schema.GroupVersionKind
+	names string
+}
+
+// exactResourceFilters returns one filter per kind and set of names, matching all namespaces the names were declared in.
+// A group without a namespace makes its filter match all namespaces.
+func exactResourceFilters(category string, groupKeys []exactResourceGroupKey, groups map[exactResourceGroupKey]*exactResourceGroup) map[schema.GroupVersionKind][]EventFilter {
+	var filterKeys []exactResourceFilterKey
+	namesOf := map[exactResourceFilterKey]sets.Set[string]{}
+	namespacesOf := map[exactResourceFilterKey]sets.Set[string]{}
+	for _, key := range groupKeys {
+		names := groups[key].names
+		if groups[key].allNames {
+			names = sets.New[string]()
+		}
+		filterKey := exactResourceFilterKey{gvk: key.gvk, names: strings.Join(sets.List(names), ",")}
+		if _, ok := namesOf[filterKey]; !ok {
+			namesOf[filterKey] = names
+			namespacesOf[filterKey] = sets.New[string]()
+			filterKeys = append(filterKeys, filterKey)
+		}
+		namespacesOf[filterKey].Insert(key.namespace)
+	}
+
+	filters := map[schema.GroupVersionKind][]EventFilter{}
+	for _, filterKey := range filterKeys {
+		namespaces := namespacesOf[filterKey]
+		if namespaces.Has("") {
+			namespaces = sets.New[string]()
+		}
+		filters[filterKey.gvk] = append(filters[filterKey.gvk], exactResourceFilter(category, namespaces, namesOf[filterKey], "", nil))
+	}
+	return filters
+}
+
+// labelSelectorFilter matches the objects in the namespace, or in all namespaces, whose labels match the selector
+// and, when the refinement has an annotation, that carry the annotation too.
+func labelSelectorFilter(category string, def libraryinputresources.LabelSelectedResource, refinement *LabelSelectedResource) (EventFilter, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&def.LabelSelector)
+	if err != nil {
+		return EventFilter{}, err
+	}
+	criteria := EventFilterCriteria{Category: category, Namespace: def.Namespace, LabelSelector: selector.String()}
+	var matchesAnnotation func(obj client.Object) bool
+	if refinement != nil && refinement.Annotation != nil {
+		if matchesAnnotation, err = annotationMatcher(*refinement.Annotation); err != nil {
+			return EventFilter{}, err
+		}
+		criteria.Annotation = refinement.Annotation.String()
+	}
+	return EventFilter{
+		Criteria: criteria,
+		Matches: func(obj client.Object) bool {
+			if def.Namespace != "" && obj.GetNamespace() != def.Namespace {
+				return false
+			}
+			if !selector.Matches(labels.Set(obj.GetLabels())) {
+				return false
+			}
+			return matchesAnnotation == nil || matchesAnnotation(obj)
+		},
+	}, nil
+}
+
+// BuildInputResourceFilters resolves the input resources of every operator, from all of their resource lists,
+// and groups the resulting filters by the GVK of the informer that feeds them.
+// The exact resources of a resource list sharing a kind are matched by a single filter per set of names,
+// so that the same names declared in several namespaces, or several names in a namespace, don't multiply the filters.
+//
+// The refinements of the operators, keyed by the operator name, are compiled into the filters of the resources they refine,
+// see InputResourceRefinements. Invalid refinements are rejected.
+//
+// Exact resources declared more than once, or by several operators, are reported in the log.
+// Resources whose namespace doesn't fit the scope of their kind are rejected,
+// exact namespaced resources without a namespace only produce a warning since they still match.
+func BuildInputResourceFilters(log logr.Logger, mapper meta.RESTMapper, inputResources map[string]*libraryinputresources.InputResources, refinements map[string]*InputResourceRefinements) (map[schema.GroupVersionKind][]EventFilter, error) {
+	reportDuplicateExactResources(log, inputResources)
+	reportSharedExactResources(log, inputResources)
+	filters := map[schema.GroupVersionKind][]EventFilter{}
+	var errs []error
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		for _, resources := range resourceListsOf(inputResources[operator]) {
+			// the exact resources are grouped by kind and namespace, see exactResourceFilters
+			var groupKeys []exactResourceGroupKey
+			groups := map[exactResourceGroupKey]*exactResourceGroup{}
+			for _, def := range resources.ExactResources {
+				gvr := gvrFor(def.InputResourceTypeIdentifier)
+				gvk, scope, err := kindAndScopeFor(mapper, gvr)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("operator %q: unable to resolve %s exact resource %s: %w", operator, resources.category, gvr, err))
+					continue
+				}
+				switch {
+				case scope == meta.RESTScopeNameRoot && def.Namespace != "":
+					errs = append(errs, fmt.Errorf("operator %q: %s exact resource %s %q is cluster-scoped but specifies namespace %q", operator, resources.category, gvr, def.Name, def.Namespace))
+					continue
+				case scope == meta.RESTScopeNameNamespace && def.Namespace == "":
+					log.Info("namespaced exact resource doesn't specify a namespace, it will match objects in all namespaces", "operator", operator, "category", resources.category, "gvr", gvr.String(), "name", def.Name)
+				}
+				// a refined exact resource can't share the filter of the others, it gets its own
+				if refinement := exactRefinementFor(refinements[operator], def); refinement != nil {
+					nameRegex, err := compileNameRegex(refinement)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("operator %q: %s exact resource %s %q: %w", operator, resources.category, gvr, def.Name, err))
+						continue
+					}
+					filters[gvk] = append(filters[gvk], exactResourceFilter(resources.category, setOfNonEmpty(def.Namespace), setOfNonEmpty(def.Name), refinement.UID, nameRegex))
+					continue
+				}
+				key := exactResourceGroupKey{gvk: gvk, namespace: def.Namespace}
+				group, ok := groups[key]
+				if !ok {
+					group = &exactResourceGroup{names: sets.New[string]()}
+					groups[key] = group
+					groupKeys = append(groupKeys, key)
+				}
+				if def.Name == "" {
+					group.allNames = true
+				}
+				group.names.Insert(def.Name)
+			}
+			for gvk, exactFilters := range exactResourceFilters(resources.category, groupKeys, groups) {
+				filters[gvk] = append(filters[gvk], exactFilters...)
+			}
+			for _, def := range resources.LabelSelectedResources {
+				gvr := gvrFor(def.InputResourceTypeIdentifier)
+				gvk, scope, err := kindAndScopeFor(mapper, gvr)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("operator %q: unable to resolve %s label selected resource %s: %w", operator, resources.category, gvr, err))
+					continue
+				}
+				if scope == meta.RESTScopeNameRoot && def.Namespace != "" {
+					errs = append(errs, fmt.Errorf("operator %q: %s label selected resource %s is cluster-scoped but specifies namespace %q", operator, resources.category, gvr, def.Namespace))
+					continue
+				}
+				filter, err := labelSelectorFilter(resources.category, def, labelSelectedRefinementFor(refinements[operator], def))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("operator %q: invalid label selected resource %s %s: %w", operator, resources.category, gvr, err))
+					continue
+				}
+				filters[gvk] = append(filters[gvk], filter)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return filters, nil
+}
+
+type exactResourceKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// duplicateExactResources counts the exact resources declared more than once,
+// by the same operator, keyed by the operator, and by several operators.
+// Every declaration after the first one counts as a duplicate, across all resource lists of an operator.
+func duplicateExactResources(inputResources map[string]*libraryinputresources.InputResources) (duplicates map[string]int, shared int) {
+	duplicates = map[string]int{}
+	operatorsOf := map[exactResourceKey]sets.Set[string]{}
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		declared := sets.New[exactResourceKey]()
+		for _, resources := range resourceListsOf(inputResources[operator]) {
+			for _, def := range resources.ExactResources {
+				key := exactResourceKey{gvr: gvrFor(def.InputResourceTypeIdentifier), namespace: def.Namespace, name: def.Name}
+				if declared.Has(key) {
+					duplicates[operator]++
+					continue
+				}
+				declared.Insert(key)
+				if _, ok := operatorsOf[key]; !ok {
+					operatorsOf[key] = sets.New[string]()
+				}
+				operatorsOf[key].Insert(operator)
+			}
+		}
+	}
+	for _, operators := range operatorsOf {
+		if operators.Len() > 1 {
+			shared++
+		}
+	}
+	return duplicates, shared
+}
+
+// reportDuplicateExactResources logs the exact resources an operator declared more than once, most likely by mistake.
+func reportDuplicateExactResources(log logr.Logger, inputResources map[string]*libraryinputresources.InputResources) {
+	duplicates, _ := duplicateExactResources(inputResources)
+	for _, operator := range sets.List(sets.KeySet(duplicates)) {
+		log.Info("warning: operator declared the same exact resources more than once, the duplicates don't change what is observed", "operator", operator, "duplicates", duplicates[operator])
+	}
+}
+
+// reportSharedExactResources logs the number of exact resources declared by several operators, which is expected,
+// their events are dispatched once and mapped to all of the operators.
+func reportSharedExactResources(log logr.Logger, inputResources map[string]*libraryinputresources.InputResources) {
+	if _, shared := duplicateExactResources(inputResources); shared > 0 {
+		log.Info("exact resources are declared by several operators", "shared", shared, "operators", len(inputResources))
+	}
+}
+
+func kindAndScopeFor(mapper meta.RESTMapper, gvr schema.GroupVersionResource) (schema.GroupVersionKind, meta.RESTScopeName, error) {
+	gvk, err := mapper.KindFor(gvr)
+	if err != nil {
+		return schema.GroupVersionKind{}, "", err
+	}
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return schema.GroupVersionKind{}, "", err
+	}
+	return gvk, mapping.Scope.Name(), nil
+}
@@ -0,0 +1,157 @@
+package dynamiccache_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache/dynamiccachetest"
+)
+
+func TestInputResourceFilters(t *testing.T) {
+	tier := "gold"
+	h := newRefinedTestHarness(t, map[string]*libraryinputresources.InputResources{
+		"a": applyConfigurationResources(
+			[]libraryinputresources.ExactResourceID{exactConfigMap("ns", "config"), exactConfigMap("ns", "shared")},
+			labelSelectedSecrets("ns", map[string]string{"app": "a"}),
+		),
+		"b": applyConfigurationResources(
+			[]libraryinputresources.ExactResourceID{exactConfigMap("ns", "shared"), exactConfigMap("", "anywhere")},
+		),
+		"c": applyConfigurationResources(nil, labelSelectedSecrets("annotated", map[string]string{"app": "c"})),
+		"d": applyConfigurationResources(nil, labelSelectedSecrets("annotated", map[string]string{"app": "d"})),
+		"e": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactConfigMap("bootstrap", "token")}),
+		"f": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactConfigMap("revisions", "")}),
+	}, map[string]*dynamiccache.InputResourceRefinements{
+		"c": {LabelSelectedResources: []dynamiccache.LabelSelectedResource{{
+			LabelSelectedResource: labelSelectedSecrets("annotated", map[string]string{"app": "c"}),
+			Annotation:            &dynamiccache.AnnotationMatch{Key: "example.com/input"},
+		}}},
+		"d": {LabelSelectedResources: []dynamiccache.LabelSelectedResource{{
+			LabelSelectedResource: labelSelectedSecrets("annotated", map[string]string{"app": "d"}),
+			Annotation:            &dynamiccache.AnnotationMatch{Key: "example.com/tier", Value: &tier},
+		}}},
+		"e": {ExactResources: []dynamiccache.ExactResource{{ExactResourceID: exactConfigMap("bootstrap", "token"), UID: "uid-1"}}},
+		"f": {ExactResources: []dynamiccache.ExactResource{{ExactResourceID: exactConfigMap("revisions", ""), NameRegex: "revision-status-[0-9]+"}}},
+	})
+
+	tests := []struct {
+		name          string
+		gvk           schema.GroupVersionKind
+		obj           client.Object
+		wantOperators []string
+	}{
+		{name: "exact resource", gvk: configMapGVK, obj: configMap("ns", "config"), wantOperators: []string{"a"}},
+		{name: "exact resource of several operators", gvk: configMapGVK, obj: configMap("ns", "shared"), wantOperators: []string{"a", "b"}},
+		{name: "exact resource in all namespaces", gvk: configMapGVK, obj: configMap("other", "anywhere"), wantOperators: []string{"b"}},
+		{name: "exact resource in another namespace", gvk: configMapGVK, obj: configMap("other", "config")},
+		{name: "other name", gvk: configMapGVK, obj: configMap("ns", "other")},
+		{name: "label selected resource", gvk: secretGVK, obj: secret("ns", "secret", map[string]string{"app": "a", "tier": "x"}), wantOperators: []string{"a"}},
+		{name: "other labels", gvk: secretGVK, obj: secret("ns", "secret", map[string]string{"app": "b"})},
+		{name: "label selected resource in another namespace", gvk: secretGVK, obj: secret("other", "secret", map[string]string{"app": "a"})},
+		{name: "annotation present", gvk: secretGVK, obj: annotated(secret("annotated", "secret", map[string]string{"app": "c"}), map[string]string{"example.com/input": ""}), wantOperators: []string{"c"}},
+		{name: "annotation missing", gvk: secretGVK, obj: annotated(secret("annotated", "secret", map[string]string{"app": "c"}), map[string]string{"example.com/other": ""})},
+		{name: "annotation value match", gvk: secretGVK, obj: annotated(secret("annotated", "secret", map[string]string{"app": "d"}), map[string]string{"example.com/tier": "gold"}), wantOperators: []string{"d"}},
+		{name: "annotation value mismatch", gvk: secretGVK, obj: annotated(secret("annotated", "secret", map[string]string{"app": "d"}), map[string]string{"example.com/tier": "silver"})},
+		{name: "exact resource with the UID", gvk: configMapGVK, obj: withUID(configMap("bootstrap", "token"), "uid-1"), wantOperators: []string{"e"}},
+		{name: "exact resource recreated with a new UID", gvk: configMapGVK, obj: withUID(configMap("bootstrap", "token"), "uid-2")},
+		{name: "name matching the regex", gvk: configMapGVK, obj: configMap("revisions", "revision-status-3"), wantOperators: []string{"f"}},
+		{name: "name not matching the regex", gvk: configMapGVK, obj: configMap("revisions", "revision-status-x")},
+		{name: "name only partly matching the regex", gvk: configMapGVK, obj: configMap("revisions", "old-revision-status-3")},
+		{name: "annotation without the labels", gvk: secretGVK, obj: annotated(secret("annotated", "secret", nil), map[string]string{"example.com/input": "", "example.com/tier": "gold"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := h.Handle(tt.gvk, tt.obj)
+			if len(tt.wantOperators) == 0 {
+				if ok {
+					t.Fatalf("expected %s to be filtered out, got an event for %v", client.ObjectKeyFromObject(tt.obj), e.Operators)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected an event for %s", client.ObjectKeyFromObject(tt.obj))
+			}
+			if !reflect.DeepEqual(e.Operators, tt.wantOperators) {
+				t.Errorf("expected the operators %v, got %v", tt.wantOperators, e.Operators)
+			}
+			if e.Object == tt.obj {
+				t.Errorf("expected a copy of the object to be dispatched")
+			}
+			if e.Object.GetObjectKind().GroupVersionKind() != tt.gvk {
+				t.Errorf("expected the dispatched object to have the GVK %v, got %v", tt.gvk, e.Object.GetObjectKind().GroupVersionKind())
+			}
+		})
+	}
+}
+
+func TestInputResourceFiltersInvalidAnnotation(t *testing.T) {
+	inputResources := map[string]*libraryinputresources.InputResources{
+		"a": applyConfigurationResources(nil, labelSelectedSecrets("ns", map[string]string{"app": "a"})),
+	}
+	refinements := map[string]*dynamiccache.InputResourceRefinements{
+		"a": {LabelSelectedResources: []dynamiccache.LabelSelectedResource{{
+			LabelSelectedResource: labelSelectedSecrets("ns", map[string]string{"app": "a"}),
+			Annotation:            &dynamiccache.AnnotationMatch{Key: "not a key"},
+		}}},
+	}
+	if _, err := dynamiccachetest.NewHarnessForRefinedInputResources(testMapper(), inputResources, refinements); err == nil || !strings.Contains(err.Error(), `invalid annotation key "not a key"`) {
+		t.Errorf("expected the invalid annotation key to be rejected, got %v", err)
+	}
+}
+
+func TestInputResourceFiltersInvalidNameRegex(t *testing.T) {
+	inputResources := map[string]*libraryinputresources.InputResources{
+		"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactConfigMap("ns", "")}),
+	}
+	refinements := map[string]*dynamiccache.InputResourceRefinements{
+		"a": {ExactResources: []dynamiccache.ExactResource{{ExactResourceID: exactConfigMap("ns", ""), NameRegex: "revision-("}}},
+	}
+	if _, err := dynamiccachetest.NewHarnessForRefinedInputResources(testMapper(), inputResources, refinements); err == nil || !strings.Contains(err.Error(), `invalid name regex "revision-("`) {
+		t.Errorf("expected the invalid name regex to be rejected, got %v", err)
+	}
+}
+
+func TestInputResourceFiltersTombstones(t *testing.T) {
+	h := newTestHarness(t, map[string]*libraryinputresources.InputResources{
+		"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactConfigMap("ns", "config")}),
+	})
+
+	t.Run("tombstone of a matching object", func(t *testing.T) {
+		e, ok := h.Handle(configMapGVK, dynamiccachetest.Tombstone(configMap("ns", "config")))
+		if !ok {
+			t.Fatal("expected an event for the tombstone")
+		}
+		if !e.Deleted {
+			t.Error("expected the tombstone to be dispatched as deleted")
+		}
+		if key := client.ObjectKeyFromObject(e.Object); key.Namespace != "ns" || key.Name != "config" {
+			t.Errorf("expected the tombstone to be unwrapped, got %s", key)
+		}
+	})
+	t.Run("tombstone of another object", func(t *testing.T) {
+		if e, ok := h.Handle(configMapGVK, dynamiccachetest.Tombstone(configMap("ns", "other"))); ok {
+			t.Fatalf("expected the tombstone to be filtered out, got an event for %v", e.Operators)
+		}
+	})
+	t.Run("tombstone without an object", func(t *testing.T) {
+		if _, ok := h.Handle(configMapGVK, toolscache.DeletedFinalStateUnknown{Key: "ns/config", Obj: "not an object"}); ok {
+			t.Fatal("expected the tombstone to be dropped")
+		}
+	})
+	t.Run("deleted object", func(t *testing.T) {
+		e, ok := h.HandleDelete(configMapGVK, configMap("ns", "config"))
+		if !ok {
+			t.Fatal("expected an event for the deleted object")
+		}
+		if !e.Deleted || !reflect.DeepEqual(e.Operators, []string{"a"}) {
+			t.Errorf("expected a deleted event for the operator a, got deleted=%v for %v", e.Deleted, e.Operators)
+		}
+	})
+}
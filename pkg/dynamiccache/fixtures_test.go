@@ -0,0 +1,88 @@
+package dynamiccache_test
+
+import (
+	"testing"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache/dynamiccachetest"
+)
+
+var (
+	configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	secretGVK    = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+)
+
+// testMapper maps the configmaps and secrets the tests declare input resources for.
+func testMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(configMapGVK, meta.RESTScopeNamespace)
+	mapper.Add(secretGVK, meta.RESTScopeNamespace)
+	return mapper
+}
+
+// newTestHarness returns a harness filtering the events with the input resources, see dynamiccachetest.NewHarnessForInputResources.
+func newTestHarness(t *testing.T, inputResources map[string]*libraryinputresources.InputResources) *dynamiccachetest.Harness {
+	t.Helper()
+	return newRefinedTestHarness(t, inputResources, nil)
+}
+
+// newRefinedTestHarness is like newTestHarness, with the refinements of the operators.
+func newRefinedTestHarness(t *testing.T, inputResources map[string]*libraryinputresources.InputResources, refinements map[string]*dynamiccache.InputResourceRefinements) *dynamiccachetest.Harness {
+	t.Helper()
+	h, err := dynamiccachetest.NewHarnessForRefinedInputResources(testMapper(), inputResources, refinements)
+	if err != nil {
+		t.Fatalf("unable to build the filters: %v", err)
+	}
+	return h
+}
+
+func exactConfigMap(namespace, name string) libraryinputresources.ExactResourceID {
+	return libraryinputresources.ExactResourceID{
+		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{Version: "v1", Resource: "configmaps"},
+		Namespace:                   namespace,
+		Name:                        name,
+	}
+}
+
+func labelSelectedSecrets(namespace string, matchLabels map[string]string) libraryinputresources.LabelSelectedResource {
+	return libraryinputresources.LabelSelectedResource{
+		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{Version: "v1", Resource: "secrets"},
+		Namespace:                   namespace,
+		LabelSelector:               metav1.LabelSelector{MatchLabels: matchLabels},
+	}
+}
+
+// applyConfigurationResources declares the resources as the apply configuration resources of an operator.
+func applyConfigurationResources(exact []libraryinputresources.ExactResourceID, labelSelected ...libraryinputresources.LabelSelectedResource) *libraryinputresources.InputResources {
+	return &libraryinputresources.InputResources{
+		ApplyConfigurationResources: libraryinputresources.ResourceList{ExactResources: exact, LabelSelectedResources: labelSelected},
+	}
+}
+
+func configMap(namespace, name string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+func secret(namespace, name string, labels map[string]string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+}
+
+// withUID sets the UID of the object and returns it.
+func withUID[T client.Object](obj T, uid types.UID) T {
+	obj.SetUID(uid)
+	return obj
+}
+
+// annotated sets the annotations of the object and returns it.
+func annotated[T client.Object](obj T, annotations map[string]string) T {
+	obj.SetAnnotations(annotations)
+	return obj
+}
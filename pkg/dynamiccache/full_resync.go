@@ -0,0 +1,109 @@
+package dynamiccache
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// ResyncObject is dispatched to force a reconcile of the operator it is named after,
+// <namespace>/<name> for namespaced operators, regardless of whether its input resources changed.
+// Map funcs set with WithMapFunc have to map it to the operator's request themselves.
+type ResyncObject struct {
+	client.Object
+}
+
+// DeepCopyObject keeps the resync marker on the copy.
+func (r *ResyncObject) DeepCopyObject() runtime.Object {
+	return &ResyncObject{Object: r.Object.DeepCopyObject().(client.Object)}
+}
+
+func newResyncObject(operator string) *ResyncObject {
+	id := operatorIdentityFor(operator)
+	return &ResyncObject{Object: &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: id.Namespace, Name: id.Name}}}
+}
+
+// Resync sends a ResyncObject for the operator to the controller, bypassing the filters.
+// Like Handle, it blocks while the buffer is full and drops the event once the dispatcher is stopped.
+// The resyncer runs apart from the initializer, so it may still tick once the dispatcher has been closed.
+func (d *EventDispatcher) Resync(operator string) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	// the events channel is closed once done is, check done first so that a closed channel is never sent to
+	select {
+	case <-d.done:
+		droppedEventsTotal.WithLabelValues(resyncEventsGVK).Inc()
+		return
+	default:
+	}
+	select {
+	case d.events <- event.GenericEvent{Object: newResyncObject(operator)}:
+	case <-d.done:
+		droppedEventsTotal.WithLabelValues(resyncEventsGVK).Inc()
+	}
+}
+
+// resyncEventsGVK labels the metrics of the resync events, which aren't about an object of any kind.
+const resyncEventsGVK = "resync"
+
+// ResyncOperators dispatches a ResyncObject for every observed operator, once the initial sync completed.
+// It returns the number of operators resynced.
+func (i *InputResourceInitializer) ResyncOperators() int {
+	if !i.HasSynced() {
+		return 0
+	}
+	operators := i.InputResources()
+	for operator := range operators {
+		i.dispatcher.Resync(operator)
+	}
+	return len(operators)
+}
+
+// FullResyncer periodically forces a reconcile of every operator, regardless of whether its input resources changed.
+// Unlike the informers' SyncPeriod, it doesn't replay the cached objects through the filters.
+type FullResyncer struct {
+	log      logr.Logger
+	interval time.Duration
+	resync   func() int
+}
+
+// FullResyncerOptions configures a FullResyncer.
+type FullResyncerOptions struct {
+	Log logr.Logger
+	// Interval is the time between two resyncs.
+	Interval time.Duration
+	// Resync forces the reconciles and returns the number of operators resynced, e.g. InputResourceInitializer.ResyncOperators.
+	Resync func() int
+}
+
+func NewFullResyncer(opts FullResyncerOptions) *FullResyncer {
+	return &FullResyncer{log: opts.Log, interval: opts.Interval, resync: opts.Resync}
+}
+
+var _ manager.LeaderElectionRunnable = (*FullResyncer)(nil)
+
+// NeedLeaderElection makes the resyncer run along the initializers, on the leader only.
+func (f *FullResyncer) NeedLeaderElection() bool {
+	return true
+}
+
+func (f *FullResyncer) Start(ctx context.Context) error {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		f.log.Info("resynced the operators", "operators", f.resync())
+	}
+}
@@ -0,0 +1,334 @@
+package dynamiccache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// operatorIdentity identifies the object representing an operator.
+type operatorIdentity struct {
+	Namespace string
+	Name      string
+}
+
+// operatorIdentityFor parses an operator name from the input resources config,
+// namespaced operators are declared as "<namespace>/<name>".
+func operatorIdentityFor(operatorName string) operatorIdentity {
+	namespace, name, err := toolscache.SplitMetaNamespaceKey(operatorName)
+	if err != nil {
+		return operatorIdentity{Name: operatorName}
+	}
+	return operatorIdentity{Namespace: namespace, Name: name}
+}
+
+// String returns the operator name as declared in the input resources config.
+func (o operatorIdentity) String() string {
+	if o.Namespace == "" {
+		return o.Name
+	}
+	return o.Namespace + "/" + o.Name
+}
+
+func requestForOperator(operator operatorIdentity, obj client.Object) reconcile.Request {
+	return reconcile.Request{NamespacedName: client.ObjectKey{Namespace: operator.Namespace, Name: operator.Name}}
+}
+
+// OperatorNameFunc returns the names of the operators an observed object belongs to, if any.
+// The controller gets one request per returned name.
+type OperatorNameFunc func(obj client.Object) []string
+
+// DefaultOperatorNameLabel is the label OperatorNameFromLabel is used with by default.
+const DefaultOperatorNameLabel = "app.kubernetes.io/part-of"
+
+// OperatorNameFromLabel returns an OperatorNameFunc reading the operator name from the label,
+// objects without the label don't belong to any operator.
+func OperatorNameFromLabel(label string) OperatorNameFunc {
+	return func(obj client.Object) []string {
+		if name := obj.GetLabels()[label]; label != "" && name != "" {
+			return []string{name}
+		}
+		return nil
+	}
+}
+
+// OperatorNameFromOwnerReferences returns an OperatorNameFunc reading the operator name from the controller owner reference,
+// restricted to owners of the kind unless it is empty. Other owners than the controller are ignored,
+// objects without a controller owner, or whose controller is of another kind, don't belong to any operator.
+func OperatorNameFromOwnerReferences(kind string) OperatorNameFunc {
+	return func(obj client.Object) []string {
+		owner := metav1.GetControllerOfNoCopy(obj)
+		if owner == nil || owner.Name == "" || (kind != "" && owner.Kind != kind) {
+			return nil
+		}
+		return []string{owner.Name}
+	}
+}
+
+// contextLogger returns the logger injected into the context, e.g. the one controller-runtime injects
+// into every reconcile carrying the controller name and the reconcile ID, with the key and value pairs added.
+// It returns the fallback when the context has no logger.
+func contextLogger(ctx context.Context, fallback logr.Logger, keysAndValues ...interface{}) logr.Logger {
+	log, err := logr.FromContext(ctx)
+	if err != nil {
+		return fallback
+	}
+	return log.WithValues(keysAndValues...)
+}
+
+// qualifiedName formats the key of an object as namespace/name, or as name only for cluster-scoped kinds.
+// The scope is taken from the mapper, the key of a kind it can't resolve is formatted by whether it has a namespace.
+func qualifiedName(mapper meta.RESTMapper, gvk schema.GroupVersionKind, key client.ObjectKey) string {
+	namespaced := key.Namespace != ""
+	if mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		namespaced = mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	}
+	if !namespaced || key.Namespace == "" {
+		return key.Name
+	}
+	return key.Namespace + "/" + key.Name
+}
+
+type operatorIndexKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+// operatorIndex maps the exact input resources to the operators that declared them.
+// An index is never modified once built: publish builds a new one whenever the observed operators change
+// and swaps it in under the initializer's publishedLock, so the readers holding the previous one keep a consistent view.
+type operatorIndex map[operatorIndexKey]sets.Set[string]
+
+func newOperatorIndex(mapper meta.RESTMapper, inputResources map[string]*libraryinputresources.InputResources) (operatorIndex, error) {
+	index := operatorIndex{}
+	for operator, resources := range inputResources {
+		for _, list := range resourceListsOf(resources) {
+			for _, def := range list.ExactResources {
+				gvk, err := mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+				if err != nil {
+					return nil, fmt.Errorf("operator %q: unable to resolve %s exact resource %s: %w", operator, list.category, gvrFor(def.InputResourceTypeIdentifier), err)
+				}
+				key := operatorIndexKey{gvk: gvk, namespace: def.Namespace, name: def.Name}
+				if _, ok := index[key]; !ok {
+					index[key] = sets.New[string]()
+				}
+				index[key].Insert(operator)
+			}
+		}
+	}
+	return index, nil
+}
+
+// operatorsFor returns the sorted names of the operators that declared the object,
+// including the ones that declared it without a namespace.
+func (idx operatorIndex) operatorsFor(gvk schema.GroupVersionKind, namespace, name string) []string {
+	operators := sets.New[string]()
+	operators = operators.Union(idx[operatorIndexKey{gvk: gvk, namespace: namespace, name: name}])
+	if namespace != "" {
+		operators = operators.Union(idx[operatorIndexKey{gvk: gvk, name: name}])
+	}
+	return sets.List(operators)
+}
+
+// Categories of the resource lists of the input resources, they tell the lists apart in logs, errors and metrics.
+const (
+	applyConfigurationCategory   = "applyConfiguration"
+	operandConfigurationCategory = "operandConfiguration"
+	operandManagementCategory    = "operandManagement"
+	operandUserWorkloadCategory  = "operandUserWorkload"
+)
+
+// categorizedResourceList is a resource list of the input resources together with its category.
+type categorizedResourceList struct {
+	category string
+	libraryinputresources.ResourceList
+}
+
+// resourceListsOf returns all resource lists of the input resources, the apply configuration resources come first.
+// Only the exact and label selected resources of the lists are observed.
+func resourceListsOf(resources *libraryinputresources.InputResources) []categorizedResourceList {
+	return []categorizedResourceList{
+		{category: applyConfigurationCategory, ResourceList: resources.ApplyConfigurationResources},
+		{category: operandConfigurationCategory, ResourceList: resources.OperandResources.ConfigurationResources},
+		{category: operandManagementCategory, ResourceList: resources.OperandResources.ManagementResources},
+		{category: operandUserWorkloadCategory, ResourceList: resources.OperandResources.UserWorkloadResources},
+	}
+}
+
+func gvrFor(id libraryinputresources.InputResourceTypeIdentifier) schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: id.Group, Version: id.Version, Resource: id.Resource}
+}
+
+// inputResourceTypeIdentifiers returns the resource types of all
+// input resources an operator declared, in declaration order.
+func inputResourceTypeIdentifiers(resources *libraryinputresources.InputResources) []libraryinputresources.InputResourceTypeIdentifier {
+	var ids []libraryinputresources.InputResourceTypeIdentifier
+	for _, list := range resourceListsOf(resources) {
+		for _, def := range list.ExactResources {
+			ids = append(ids, def.InputResourceTypeIdentifier)
+		}
+		for _, def := range list.LabelSelectedResources {
+			ids = append(ids, def.InputResourceTypeIdentifier)
+		}
+	}
+	return ids
+}
+
+// WatchFromExactResourceID resolves the kind of the exact resource and returns an empty object to watch it with.
+func WatchFromExactResourceID(mapper meta.RESTMapper, scheme *runtime.Scheme, def libraryinputresources.ExactResourceID, opts ObjectOptions) (schema.GroupVersionKind, client.Object, error) {
+	gvk, err := mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+	if err != nil {
+		return schema.GroupVersionKind{}, nil, err
+	}
+
+	obj, err := newObjectFor(scheme, gvk, opts)
+	if err != nil {
+		return schema.GroupVersionKind{}, nil, err
+	}
+	return gvk, obj, nil
+}
+
+// exactOnlyKinds returns the kinds that are only referenced by exact resources.
+func exactOnlyKinds(mapper meta.RESTMapper, inputResources map[string]*libraryinputresources.InputResources) (sets.Set[schema.GroupVersionKind], error) {
+	exactKinds := sets.New[schema.GroupVersionKind]()
+	labelSelectedKinds := sets.New[schema.GroupVersionKind]()
+	for operator, resources := range inputResources {
+		for _, list := range resourceListsOf(resources) {
+			for _, def := range list.ExactResources {
+				gvk, err := mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+				if err != nil {
+					return nil, fmt.Errorf("operator %q: unable to resolve %s exact resource %s: %w", operator, list.category, gvrFor(def.InputResourceTypeIdentifier), err)
+				}
+				exactKinds.Insert(gvk)
+			}
+			for _, def := range list.LabelSelectedResources {
+				gvk, err := mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+				if err != nil {
+					return nil, fmt.Errorf("operator %q: unable to resolve %s label selected resource %s: %w", operator, list.category, gvrFor(def.InputResourceTypeIdentifier), err)
+				}
+				labelSelectedKinds.Insert(gvk)
+			}
+		}
+	}
+	return exactKinds.Difference(labelSelectedKinds), nil
+}
+
+type CacheObjectMode string
+
+const (
+	TypedCacheObjectMode        CacheObjectMode = "typed"
+	UnstructuredCacheObjectMode CacheObjectMode = "unstructured"
+)
+
+// redactedValue replaces the values of the Secrets' data in everything written out for humans, e.g. the debug endpoints.
+const redactedValue = "<redacted>"
+
+// secretDataFields are the fields of a Secret holding its values.
+var secretDataFields = []string{"data", "stringData"}
+
+func isSecret(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == "" && gvk.Kind == "Secret"
+}
+
+// redactSecretData replaces the values of the data and stringData of the content of a Secret with redactedValue,
+// the keys are kept. The content of other kinds is left alone.
+func redactSecretData(gvk schema.GroupVersionKind, content map[string]interface{}) {
+	if !isSecret(gvk) {
+		return
+	}
+	for _, field := range secretDataFields {
+		values, ok := content[field].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key := range values {
+			values[key] = redactedValue
+		}
+	}
+}
+
+// ObjectOptions controls which objects are used to read and watch the input resources.
+type ObjectOptions struct {
+	// Mode selects between typed and unstructured objects, an empty mode means typed
+	Mode CacheObjectMode
+	// UnstructuredFallback makes the typed mode use unstructured objects for kinds missing from the scheme,
+	// so that kinds like CRDs can be used without registering their types
+	UnstructuredFallback bool
+	// MetadataOnlyKinds are read and watched as metav1.PartialObjectMetadata regardless of the mode
+	MetadataOnlyKinds sets.Set[schema.GroupVersionKind]
+}
+
+// newObjectFor returns an empty object of the GVK, typed or unstructured depending on the options.
+func newObjectFor(scheme *runtime.Scheme, gvk schema.GroupVersionKind, opts ObjectOptions) (client.Object, error) {
+	newUnstructured := func() client.Object {
+		uobj := &unstructured.Unstructured{}
+		uobj.SetGroupVersionKind(gvk)
+		return uobj
+	}
+	if opts.MetadataOnlyKinds.Has(gvk) {
+		pobj := &metav1.PartialObjectMetadata{}
+		pobj.SetGroupVersionKind(gvk)
+		return pobj, nil
+	}
+	if opts.Mode == UnstructuredCacheObjectMode {
+		return newUnstructured(), nil
+	}
+
+	obj, err := scheme.New(gvk)
+	if err != nil {
+		if !opts.UnstructuredFallback || !runtime.IsNotRegisteredError(err) {
+			return nil, err
+		}
+		return newUnstructured(), nil
+	}
+
+	cobj, ok := obj.(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("type %T does not implement client.Object", obj)
+	}
+	return cobj, nil
+}
+
+// newObjectListFor is like newObjectFor, but returns a list of the GVK.
+func newObjectListFor(scheme *runtime.Scheme, gvk schema.GroupVersionKind, opts ObjectOptions) (client.ObjectList, error) {
+	listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+	newUnstructuredList := func() client.ObjectList {
+		ulist := &unstructured.UnstructuredList{}
+		ulist.SetGroupVersionKind(listGVK)
+		return ulist
+	}
+	if opts.MetadataOnlyKinds.Has(gvk) {
+		plist := &metav1.PartialObjectMetadataList{}
+		plist.SetGroupVersionKind(listGVK)
+		return plist, nil
+	}
+	if opts.Mode == UnstructuredCacheObjectMode {
+		return newUnstructuredList(), nil
+	}
+
+	obj, err := scheme.New(listGVK)
+	if err != nil {
+		if !opts.UnstructuredFallback || !runtime.IsNotRegisteredError(err) {
+			return nil, err
+		}
+		return newUnstructuredList(), nil
+	}
+
+	list, ok := obj.(client.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("type %T does not implement client.ObjectList", obj)
+	}
+	return list, nil
+}
@@ -0,0 +1,46 @@
+package dynamiccache
+
+import (
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	configMapGVK  = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+	secretGVK     = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+)
+
+// testMapper maps the configmaps, secrets and deployments the tests declare input resources for.
+func testMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{configMapGVK, secretGVK, deploymentGVK} {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	return mapper
+}
+
+func exactResource(group, version, resource, namespace, name string) libraryinputresources.ExactResourceID {
+	return libraryinputresources.ExactResourceID{
+		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{Group: group, Version: version, Resource: resource},
+		Namespace:                   namespace,
+		Name:                        name,
+	}
+}
+
+func labelSelectedResource(group, version, resource, namespace string, matchLabels map[string]string) libraryinputresources.LabelSelectedResource {
+	return libraryinputresources.LabelSelectedResource{
+		InputResourceTypeIdentifier: libraryinputresources.InputResourceTypeIdentifier{Group: group, Version: version, Resource: resource},
+		Namespace:                   namespace,
+		LabelSelector:               metav1.LabelSelector{MatchLabels: matchLabels},
+	}
+}
+
+// applyConfigurationResources declares the resources as the apply configuration resources of an operator.
+func applyConfigurationResources(exact []libraryinputresources.ExactResourceID, labelSelected ...libraryinputresources.LabelSelectedResource) *libraryinputresources.InputResources {
+	return &libraryinputresources.InputResources{
+		ApplyConfigurationResources: libraryinputresources.ResourceList{ExactResources: exact, LabelSelectedResources: labelSelected},
+	}
+}
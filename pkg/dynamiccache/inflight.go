@@ -0,0 +1,50 @@
+package dynamiccache
+
+import (
+	"context"
+	"sync"
+)
+
+// inFlightOperators guards the operators being reconciled, so that an operator is never reconciled twice at once
+// even when Reconcile is called outside of the controller's workqueue, which only dedups the queued requests.
+// It only holds the operators in flight, so it is bounded by the number of concurrent reconciles.
+// The zero value is ready to use.
+type inFlightOperators struct {
+	lock sync.Mutex
+	// operators hold a channel per operator in flight, closed once its reconcile completes
+	operators map[string]chan struct{}
+}
+
+// Acquire waits until no other reconcile of the operator is in flight and marks it in flight,
+// the returned func has to be called once the reconcile completes.
+// A reconcile waiting for another one adds its latency, which is bounded by the duration of a reconcile.
+// It returns the context's error when the context is done before.
+func (f *inFlightOperators) Acquire(ctx context.Context, operator string) (release func(), waited bool, err error) {
+	for {
+		f.lock.Lock()
+		if f.operators == nil {
+			f.operators = map[string]chan struct{}{}
+		}
+		done, inFlight := f.operators[operator]
+		if !inFlight {
+			done = make(chan struct{})
+			f.operators[operator] = done
+			f.lock.Unlock()
+			return func() {
+				f.lock.Lock()
+				defer f.lock.Unlock()
+
+				delete(f.operators, operator)
+				close(done)
+			}, waited, nil
+		}
+		f.lock.Unlock()
+
+		waited = true
+		select {
+		case <-ctx.Done():
+			return nil, waited, ctx.Err()
+		case <-done:
+		}
+	}
+}
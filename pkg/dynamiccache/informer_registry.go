@@ -0,0 +1,152 @@
+package dynamiccache
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// informerRegistry counts the operators referencing each GVK,
+// so that an informer shared by several operators is only torn down
+// once the last of them stops needing it.
+type informerRegistry struct {
+	lock      sync.Mutex
+	operators map[schema.GroupVersionKind]sets.Set[string]
+	handlers  map[schema.GroupVersionKind]toolscache.ResourceEventHandlerRegistration
+	informers map[schema.GroupVersionKind]cache.Informer
+	// registering serializes the registration of the informer of a GVK, see LockGVK
+	registering map[schema.GroupVersionKind]*sync.Mutex
+}
+
+func newInformerRegistry() *informerRegistry {
+	return &informerRegistry{
+		operators: map[schema.GroupVersionKind]sets.Set[string]{},
+		handlers:  map[schema.GroupVersionKind]toolscache.ResourceEventHandlerRegistration{},
+		informers: map[schema.GroupVersionKind]cache.Informer{},
+
+		registering: map[schema.GroupVersionKind]*sync.Mutex{},
+	}
+}
+
+// LockGVK serializes the registrations of the informer of the GVK, it returns the function releasing the lock.
+// Holding it from Add until the informer is registered, or the reference removed again on failure,
+// ensures that an operator sharing the GVK either finds the informer registered or registers it itself.
+func (r *informerRegistry) LockGVK(gvk schema.GroupVersionKind) func() {
+	r.lock.Lock()
+	gvkLock, ok := r.registering[gvk]
+	if !ok {
+		gvkLock = &sync.Mutex{}
+		r.registering[gvk] = gvkLock
+	}
+	r.lock.Unlock()
+
+	gvkLock.Lock()
+	return gvkLock.Unlock
+}
+
+// Add records that the operator references the GVK.
+// It returns true when this is the first reference to the GVK,
+// meaning the caller is responsible for registering its informer.
+func (r *informerRegistry) Add(operator string, gvk schema.GroupVersionKind) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	operators, ok := r.operators[gvk]
+	if !ok {
+		operators = sets.New[string]()
+		r.operators[gvk] = operators
+	}
+	operators.Insert(operator)
+	return !ok
+}
+
+// Remove drops the operator's reference to the GVK.
+// It returns true when no operator references the GVK anymore,
+// meaning the caller is responsible for removing its informer.
+func (r *informerRegistry) Remove(operator string, gvk schema.GroupVersionKind) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	operators, ok := r.operators[gvk]
+	if !ok {
+		return false
+	}
+	operators.Delete(operator)
+	if operators.Len() > 0 {
+		return false
+	}
+	delete(r.operators, gvk)
+	return true
+}
+
+// Count returns the number of operators referencing the GVK.
+func (r *informerRegistry) Count(gvk schema.GroupVersionKind) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.operators[gvk].Len()
+}
+
+// GVKs returns the GVKs referenced by at least one operator.
+func (r *informerRegistry) GVKs() []schema.GroupVersionKind {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	gvks := make([]schema.GroupVersionKind, 0, len(r.operators))
+	for gvk := range r.operators {
+		gvks = append(gvks, gvk)
+	}
+	return gvks
+}
+
+// Operators returns the sorted names of the operators referencing the GVK.
+func (r *informerRegistry) Operators(gvk schema.GroupVersionKind) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return sets.List(r.operators[gvk])
+}
+
+// SetHandler records the informer registered for the GVK and the event handler added to it.
+func (r *informerRegistry) SetHandler(gvk schema.GroupVersionKind, informer cache.Informer, handler toolscache.ResourceEventHandlerRegistration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.informers[gvk] = informer
+	r.handlers[gvk] = handler
+}
+
+// TakeHandler returns the event handler registered for the GVK and forgets it, together with its informer.
+func (r *informerRegistry) TakeHandler(gvk schema.GroupVersionKind) (toolscache.ResourceEventHandlerRegistration, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	handler, ok := r.handlers[gvk]
+	delete(r.handlers, gvk)
+	delete(r.informers, gvk)
+	return handler, ok
+}
+
+// Informer returns the informer registered for the GVK.
+func (r *informerRegistry) Informer(gvk schema.GroupVersionKind) (cache.Informer, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	informer, ok := r.informers[gvk]
+	return informer, ok
+}
+
+// Informers returns the registered informers keyed by their GVK.
+func (r *informerRegistry) Informers() map[schema.GroupVersionKind]cache.Informer {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	informers := make(map[schema.GroupVersionKind]cache.Informer, len(r.informers))
+	for gvk, informer := range r.informers {
+		informers[gvk] = informer
+	}
+	return informers
+}
@@ -0,0 +1,940 @@
+package dynamiccache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// InputResourceInitializer discovers the input resources all operators declared on a cluster,
+// configures the dispatcher's filters and starts the informers that feed it.
+// The synced channel is closed once all informers have synced,
+// when the initial sync fails its error is sent to the syncErr channel instead.
+type InputResourceInitializer struct {
+	log logr.Logger
+
+	cluster       InputResourceCluster
+	discovery     discovery.DiscoveryInterface
+	scheme        *runtime.Scheme
+	objectOptions ObjectOptions
+
+	dispatcher *EventDispatcher
+	informers  *informerRegistry
+	// informerStartupConcurrency bounds the number of informers registered at once
+	informerStartupConcurrency int
+	// eventHandlerStagger bounds the random delay before an event handler is added to an informer, zero disables it
+	eventHandlerStagger time.Duration
+	// syncDelay is waited before every sync attempt, see defaultSyncDelay
+	syncDelay time.Duration
+	// restrictedCache makes AddOperator reject the input resources hidden by the restriction of the cache, see checkCacheRestrictions
+	restrictedCache bool
+	// maxCachedObjectsPerGVK fails the sync when an informer holds more objects, zero disables the limit
+	maxCachedObjectsPerGVK int
+	// tolerantPartialSync lets the sync complete without the informers that don't sync in time, see partialSyncTimeout
+	tolerantPartialSync bool
+	synced              chan struct{}
+	// syncedOnce closes the synced channel exactly once, see markSynced
+	syncedOnce sync.Once
+	syncErr    chan error
+
+	// lock serializes changes to the set of observed operators
+	lock           sync.Mutex
+	inputResources map[string]*libraryinputresources.InputResources
+
+	// publishedLock guards the input resources and the operator index read by the controller,
+	// they are published separately so that readers don't wait for informers to sync.
+	publishedLock           sync.RWMutex
+	publishedInputResources map[string]*libraryinputresources.InputResources
+	publishedOperatorIndex  operatorIndex
+	// syncedOperators are the published operators whose informers have synced
+	syncedOperators sets.Set[string]
+
+	// deletedLock guards the deleted objects
+	deletedLock sync.Mutex
+	// deletedObjects hold the last known state of the deleted input resources per operator, until the operator is reconciled
+	deletedObjects map[string][]deletedObject
+
+	// fallbacksLock guards the GVKs read as unstructured objects in the typed mode, since their types aren't registered
+	fallbacksLock         sync.Mutex
+	unstructuredFallbacks sets.Set[string]
+
+	// operatorWatch, when set, adds the operators represented by CRs, see OperatorWatch
+	operatorWatch *OperatorWatch
+	// watchedOperatorsLock guards the operators added from their CRs
+	watchedOperatorsLock sync.Mutex
+	watchedOperators     sets.Set[string]
+
+	onOperatorRemoved func(operator string)
+}
+
+// deletedObject is the last known state of a deleted input resource.
+type deletedObject struct {
+	gvk schema.GroupVersionKind
+	obj client.Object
+}
+
+var _ manager.LeaderElectionRunnable = (*InputResourceInitializer)(nil)
+
+// InputResourceInitializerOptions configures an InputResourceInitializer.
+type InputResourceInitializerOptions struct {
+	Log logr.Logger
+	// Cluster holds the input resources to observe and the cache and mapper to observe them with.
+	Cluster InputResourceCluster
+	// Discovery verifies that the cluster serves the input resources.
+	Discovery     discovery.DiscoveryInterface
+	Scheme        *runtime.Scheme
+	ObjectOptions ObjectOptions
+	// EventBufferSize defaults to DefaultEventBufferSize, see NewEventDispatcher.
+	EventBufferSize int
+	// Audit is passed to the dispatcher, see EventDispatcherOptions.
+	Audit AuditFunc
+	// InformerStartupConcurrency is the number of informers registered at once while syncing,
+	// defaults to DefaultInformerStartupConcurrency.
+	InformerStartupConcurrency int
+	// PerObjectRate and PerObjectBurst are passed to the dispatcher, see EventDispatcherOptions.
+	PerObjectRate  float64
+	PerObjectBurst int
+	// TolerantPartialSync makes the sync complete without the informers that don't sync within partialSyncTimeout,
+	// instead of failing. They keep syncing in the background and are reported by UnsyncedInformers until they do.
+	TolerantPartialSync bool
+	// MaxCachedObjectsPerGVK fails the initial sync when the informer of a kind holds more objects,
+	// e.g. because an input resource selects all secrets of the cluster by mistake. Zero disables the limit.
+	MaxCachedObjectsPerGVK int
+	// EventHandlerStagger delays adding the event handler of every informer by a random duration of up to this long,
+	// so that the informers syncing at once don't replay their stores through the dispatcher at the same time.
+	// Zero disables the delay.
+	EventHandlerStagger time.Duration
+	// OperatorWatch, when set, watches the CRs representing operators once the initial sync completed,
+	// and adds, changes and removes their operators along the CRs. Reload leaves these operators alone.
+	OperatorWatch *OperatorWatch
+	// RestrictedCache tells that the cache of the Cluster is restricted to its InputResources with InputResourceCacheOptions.
+	// The restriction can't change once the cache started, so AddOperator rejects the input resources it would hide.
+	RestrictedCache bool
+	// OnOperatorRemoved, when set, is called once an operator has been removed, e.g. to drop the state kept about it.
+	OnOperatorRemoved func(operator string)
+}
+
+// defaultSyncDelay is waited before syncing the input resources.
+const defaultSyncDelay = 5 * time.Second
+
+// DefaultInformerStartupConcurrency is the number of informers an initializer registers at once by default.
+const DefaultInformerStartupConcurrency = 4
+
+// NewInputResourceInitializer creates an initializer, it has to be added to a manager to start observing the cluster.
+func NewInputResourceInitializer(opts InputResourceInitializerOptions) *InputResourceInitializer {
+	informerStartupConcurrency := opts.InformerStartupConcurrency
+	if informerStartupConcurrency <= 0 {
+		informerStartupConcurrency = DefaultInformerStartupConcurrency
+	}
+	return &InputResourceInitializer{
+		log:           opts.Log.WithValues("cluster", opts.Cluster.Name),
+		cluster:       opts.Cluster,
+		discovery:     opts.Discovery,
+		scheme:        opts.Scheme,
+		objectOptions: opts.ObjectOptions,
+		dispatcher: NewEventDispatcher(EventDispatcherOptions{
+			Log:            opts.Log.WithValues("cluster", opts.Cluster.Name),
+			BufferSize:     opts.EventBufferSize,
+			Audit:          opts.Audit,
+			PerObjectRate:  opts.PerObjectRate,
+			PerObjectBurst: opts.PerObjectBurst,
+		}),
+		informers: newInformerRegistry(),
+
+		informerStartupConcurrency: informerStartupConcurrency,
+		tolerantPartialSync:        opts.TolerantPartialSync,
+		maxCachedObjectsPerGVK:     opts.MaxCachedObjectsPerGVK,
+		eventHandlerStagger:        opts.EventHandlerStagger,
+		synced:                     make(chan struct{}),
+		syncErr:                    make(chan error, 1),
+		inputResources:             map[string]*libraryinputresources.InputResources{},
+		deletedObjects:             map[string][]deletedObject{},
+		operatorWatch:              opts.OperatorWatch,
+		restrictedCache:            opts.RestrictedCache,
+		onOperatorRemoved:          opts.OnOperatorRemoved,
+		syncDelay:                  defaultSyncDelay,
+		syncedOperators:            sets.New[string](),
+		watchedOperators:           sets.New[string](),
+		unstructuredFallbacks:      sets.New[string](),
+	}
+}
+
+// NeedLeaderElection makes the manager start the initializer on the leader only.
+// The cache itself runs on every replica, but the event handlers feeding the dispatcher
+// are only registered by Start, so standby replicas never push events.
+func (i *InputResourceInitializer) NeedLeaderElection() bool {
+	return true
+}
+
+// Start syncs the input resources of the cluster and, once the context is done,
+// closes the dispatcher, dropping the events held back by the per-object rate limit.
+// The dispatcher stops accepting events as soon as the context is done, so that informers blocked on a full buffer
+// return right away instead of waiting for a controller that is shutting down too.
+// It is closed as well when the sync fails.
+func (i *InputResourceInitializer) Start(ctx context.Context) error {
+	stopDispatcher := context.AfterFunc(ctx, i.dispatcher.Stop)
+	defer stopDispatcher()
+	defer i.closeDispatcher()
+
+	if err := i.syncInputResources(ctx); err != nil {
+		return err
+	}
+	if i.operatorWatch != nil && ctx.Err() == nil {
+		if err := i.watchOperators(ctx); err != nil {
+			return fmt.Errorf("cluster %q: %w", i.cluster.Name, err)
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// closeDispatcher closes the dispatcher, reporting the events left in its buffer and the held back events dropped.
+func (i *InputResourceInitializer) closeDispatcher() {
+	buffered, dropped := i.dispatcher.Close()
+	i.log.Info("closed the event dispatcher", "buffered", buffered, "dropped", dropped)
+}
+
+// syncInputResources syncs the input resources of the cluster.
+// A failure stops the manager, unless the cluster is isolated, in which case the sync is retried with a backoff,
+// so that e.g. a guest cluster being unreachable doesn't affect the management cluster.
+func (i *InputResourceInitializer) syncInputResources(ctx context.Context) error {
+	if !i.cluster.Isolated {
+		if err := i.start(ctx); err != nil {
+			err = fmt.Errorf("cluster %q: %w", i.cluster.Name, err)
+			i.syncErr <- err
+			return err
+		}
+		return nil
+	}
+
+	backoff := wait.Backoff{Duration: time.Second, Factor: 2, Jitter: 0.1, Steps: math.MaxInt32, Cap: 5 * time.Minute}
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		if err := i.start(ctx); err != nil {
+			contextLogger(ctx, i.log, "cluster", i.cluster.Name).Error(err, "failed to sync the input resources, retrying")
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("cluster %q: %w", i.cluster.Name, err)
+	}
+	return nil
+}
+
+func (i *InputResourceInitializer) start(ctx context.Context) error {
+	log := contextLogger(ctx, i.log, "cluster", i.cluster.Name)
+	log.Info("syncing the input resources")
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(i.syncDelay):
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	inputResources := i.cluster.InputResources
+	if err := validateInputResources(inputResources, i.cluster.Refinements); err != nil {
+		return err
+	}
+	if err := checkSupportedInputResources(i.discovery, inputResources); err != nil {
+		return err
+	}
+	// the filters are built per operator, the resources shared by several operators are reported here
+	reportSharedExactResources(log, inputResources)
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		filters, err := BuildInputResourceFilters(log, i.cluster.Mapper, map[string]*libraryinputresources.InputResources{operator: inputResources[operator]}, i.cluster.Refinements)
+		if err != nil {
+			return err
+		}
+		i.dispatcher.SetFilters(operator, filters)
+	}
+	i.publish(inputResources)
+
+	if err := i.startAndWaitForInformersFor(ctx, inputResources); err != nil {
+		return err
+	}
+	if err := i.checkCachedObjectCounts(); err != nil {
+		return err
+	}
+	for operator, resources := range inputResources {
+		i.inputResources[operator] = resources
+	}
+	i.logStartupSummary(log)
+	i.markSynced()
+	return nil
+}
+
+// markSynced closes the synced channel, it is safe to call several times, e.g. by retried syncs.
+func (i *InputResourceInitializer) markSynced() {
+	i.syncedOnce.Do(func() {
+		close(i.synced)
+	})
+}
+
+// Synced returns a channel closed once the initial sync completed,
+// from then on the cache can be read for the input resources of the operators. It is never closed when the sync fails.
+func (i *InputResourceInitializer) Synced() <-chan struct{} {
+	return i.synced
+}
+
+// HasSynced reports whether the initial sync completed, see Synced.
+func (i *InputResourceInitializer) HasSynced() bool {
+	select {
+	case <-i.synced:
+		return true
+	default:
+		return false
+	}
+}
+
+// cachedObjectCounts returns the number of objects held by the store of every registered informer.
+// The store is only reachable on the client-go informers, which back the informer cache,
+// the kinds whose informer doesn't expose one are left out.
+func (i *InputResourceInitializer) cachedObjectCounts() map[schema.GroupVersionKind]int {
+	counts := map[schema.GroupVersionKind]int{}
+	for gvk, informer := range i.informers.Informers() {
+		if storeInformer, ok := informer.(interface{ GetStore() toolscache.Store }); ok {
+			counts[gvk] = len(storeInformer.GetStore().ListKeys())
+		}
+	}
+	return counts
+}
+
+// checkCachedObjectCounts reports every kind whose informer holds more than maxCachedObjectsPerGVK objects.
+func (i *InputResourceInitializer) checkCachedObjectCounts() error {
+	if i.maxCachedObjectsPerGVK <= 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for gvk, count := range i.cachedObjectCounts() {
+		counts[gvk.String()] = count
+	}
+	var errs []error
+	for _, gvk := range sets.List(sets.KeySet(counts)) {
+		if counts[gvk] > i.maxCachedObjectsPerGVK {
+			errs = append(errs, fmt.Errorf("the informer for %s holds %d objects, more than the limit of %d, check the input resources selecting it", gvk, counts[gvk], i.maxCachedObjectsPerGVK))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// logStartupSummary logs what the initial sync ended up observing: the operators, the informers,
+// the number of objects held by every informer's store and the number of filters fed by the informers.
+func (i *InputResourceInitializer) logStartupSummary(log logr.Logger) {
+	filters := 0
+	for _, gvkFilters := range i.dispatcher.FilterCriteria() {
+		for _, criteria := range gvkFilters {
+			filters += len(criteria)
+		}
+	}
+	objects := map[string]int{}
+	for gvk, count := range i.cachedObjectCounts() {
+		objects[gvk.String()] = count
+	}
+	log.Info("synced the input resources", "operators", len(i.cluster.InputResources), "gvks", len(i.informers.GVKs()), "filters", filters, "objects", objects, "unstructuredFallbacks", i.UnstructuredFallbacks())
+}
+
+// AddOperator starts observing the input resources of an operator discovered after the initial sync.
+// Informers are only started for kinds no other operator observes yet,
+// objects already cached for the other kinds are replayed through the new filters.
+func (i *InputResourceInitializer) AddOperator(ctx context.Context, name string, resources *libraryinputresources.InputResources) error {
+	if !i.HasSynced() {
+		return fmt.Errorf("unable to add operator %q, the input resources have not been synced yet", name)
+	}
+
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if _, ok := i.inputResources[name]; ok {
+		return fmt.Errorf("operator %q is already observed", name)
+	}
+	operatorInputResources := map[string]*libraryinputresources.InputResources{name: resources}
+	if err := validateInputResources(operatorInputResources, i.cluster.Refinements); err != nil {
+		return err
+	}
+	if err := checkSupportedInputResources(i.discovery, operatorInputResources); err != nil {
+		return err
+	}
+	if i.restrictedCache {
+		if err := checkCacheRestrictions(i.cluster.Mapper, i.scheme, i.objectOptions, i.cluster.InputResources, name, resources); err != nil {
+			return err
+		}
+	}
+	filters, err := BuildInputResourceFilters(i.log, i.cluster.Mapper, operatorInputResources, i.cluster.Refinements)
+	if err != nil {
+		return err
+	}
+	var sharedGVKs []schema.GroupVersionKind
+	for gvk := range filters {
+		if i.informers.Count(gvk) > 0 {
+			sharedGVKs = append(sharedGVKs, gvk)
+		}
+	}
+	i.dispatcher.SetFilters(name, filters)
+	i.publish(withOperator(i.inputResources, name, resources))
+
+	// rollback leaves the operator unobserved, as it was before, when its informers can't be started or replayed
+	rollback := func() {
+		i.dispatcher.RemoveFilters(name)
+		i.publish(i.inputResources)
+		for gvk := range filters {
+			if releaseErr := i.releaseInformerFor(ctx, name, gvk); releaseErr != nil {
+				i.log.Error(releaseErr, "failed to release informer", "operator", name, "gvk", gvk.String())
+			}
+		}
+	}
+	if err := i.startAndWaitForInformersFor(ctx, operatorInputResources); err != nil {
+		rollback()
+		return err
+	}
+	for _, gvk := range sharedGVKs {
+		if err := i.replayCachedObjectsFor(ctx, gvk); err != nil {
+			rollback()
+			return fmt.Errorf("operator %q: unable to replay the cached objects of %s: %w", name, gvk, err)
+		}
+	}
+	i.inputResources[name] = resources
+	i.log.Info("added operator", "operator", name)
+	return nil
+}
+
+// RemoveOperator stops observing the input resources of an operator.
+// Events already queued for the operator are still delivered, but no new ones are dispatched once its filters are removed.
+// Informers are only removed for kinds no other operator observes.
+// The operator is removed even when releasing some of its informers fails, all failures are returned together.
+func (i *InputResourceInitializer) RemoveOperator(ctx context.Context, name string) error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	resources, ok := i.inputResources[name]
+	if !ok {
+		return fmt.Errorf("operator %q is not observed", name)
+	}
+	// resolves the kinds first, so that the operator is left observed when one of them can't be resolved
+	var gvks []schema.GroupVersionKind
+	for _, id := range inputResourceTypeIdentifiers(resources) {
+		gvk, err := i.cluster.Mapper.KindFor(gvrFor(id))
+		if err != nil {
+			return fmt.Errorf("operator %q: unable to resolve %s: %w", name, gvrFor(id), err)
+		}
+		gvks = append(gvks, gvk)
+	}
+
+	i.dispatcher.RemoveFilters(name)
+	delete(i.inputResources, name)
+	i.publish(i.inputResources)
+	i.takeDeletedObjects(name)
+	if i.onOperatorRemoved != nil {
+		i.onOperatorRemoved(name)
+	}
+
+	// the operator is gone already, a failed release must not leak the informers of the remaining kinds
+	var errs []error
+	for _, gvk := range gvks {
+		if err := i.releaseInformerFor(ctx, name, gvk); err != nil {
+			errs = append(errs, fmt.Errorf("operator %q: unable to release the informer of %s: %w", name, gvk, err))
+		}
+	}
+	i.log.Info("removed operator", "operator", name)
+	return utilerrors.NewAggregate(errs)
+}
+
+// Reload makes the observed operators match the input resources,
+// operators that are gone are removed, new ones are added and changed ones are removed and added again.
+// All failures are returned together, the operators that failed are left as they were before, or removed.
+// The operators added from their CRs are left alone, see OperatorWatch.
+func (i *InputResourceInitializer) Reload(ctx context.Context, inputResources map[string]*libraryinputresources.InputResources) error {
+	current := i.InputResources()
+
+	var errs []error
+	for _, name := range sets.List(sets.KeySet(current)) {
+		if i.isWatchedOperator(name) {
+			continue
+		}
+		if resources, ok := inputResources[name]; ok && equality.Semantic.DeepEqual(resources, current[name]) {
+			continue
+		}
+		if err := i.RemoveOperator(ctx, name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, name := range sets.List(sets.KeySet(inputResources)) {
+		if resources, ok := current[name]; ok && equality.Semantic.DeepEqual(resources, inputResources[name]) {
+			continue
+		}
+		if err := i.AddOperator(ctx, name, inputResources[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// InputResources returns the input resources of the observed operators, keyed by the operator name.
+func (i *InputResourceInitializer) InputResources() map[string]*libraryinputresources.InputResources {
+	i.publishedLock.RLock()
+	defer i.publishedLock.RUnlock()
+
+	return i.publishedInputResources
+}
+
+// OperatorsFor returns the sorted names of the operators that declared the object as an exact resource.
+func (i *InputResourceInitializer) OperatorsFor(gvk schema.GroupVersionKind, namespace, name string) []string {
+	i.publishedLock.RLock()
+	defer i.publishedLock.RUnlock()
+
+	return i.publishedOperatorIndex.operatorsFor(gvk, namespace, name)
+}
+
+// publish makes the input resources and their operator index visible to the controller.
+// The map is copied, so the caller can keep modifying it.
+func (i *InputResourceInitializer) publish(inputResources map[string]*libraryinputresources.InputResources) {
+	published := withOperator(inputResources, "", nil)
+	index, err := newOperatorIndex(i.cluster.Mapper, published)
+	if err != nil {
+		// the resources have been resolved by the filters already, keep the previous index in the unlikely case
+		i.log.Error(err, "failed to index the operators of the input resources")
+		index = i.publishedOperatorIndex
+	}
+
+	i.publishedLock.Lock()
+	defer i.publishedLock.Unlock()
+
+	i.publishedInputResources = published
+	i.publishedOperatorIndex = index
+	for _, operator := range sets.List(i.syncedOperators) {
+		if _, ok := published[operator]; !ok {
+			i.syncedOperators.Delete(operator)
+			operatorSynced.DeleteLabelValues(i.cluster.Name, operator)
+		}
+	}
+	for operator := range published {
+		if !i.syncedOperators.Has(operator) {
+			operatorSynced.WithLabelValues(i.cluster.Name, operator).Set(0)
+		}
+	}
+}
+
+// markOperatorSynced records that the informers of the operator have synced.
+func (i *InputResourceInitializer) markOperatorSynced(operator string) {
+	i.publishedLock.Lock()
+	defer i.publishedLock.Unlock()
+
+	i.syncedOperators.Insert(operator)
+	operatorSynced.WithLabelValues(i.cluster.Name, operator).Set(1)
+}
+
+// SyncedOperators returns the sorted names of the observed operators whose informers have synced.
+// The initial sync completes once all operators have synced, but an operator doesn't wait for the others.
+func (i *InputResourceInitializer) SyncedOperators() []string {
+	i.publishedLock.RLock()
+	defer i.publishedLock.RUnlock()
+
+	return sets.List(i.syncedOperators)
+}
+
+// UnsyncedOperators returns the sorted names of the observed operators whose informers haven't synced yet.
+func (i *InputResourceInitializer) UnsyncedOperators() []string {
+	i.publishedLock.RLock()
+	defer i.publishedLock.RUnlock()
+
+	return sets.List(sets.KeySet(i.publishedInputResources).Difference(i.syncedOperators))
+}
+
+// UnsyncedInformers returns the sorted GVKs whose registered informer hasn't synced,
+// and updates the informer synced gauge of every registered informer on the way.
+func (i *InputResourceInitializer) UnsyncedInformers() []string {
+	var unsynced []string
+	for gvk, informer := range i.informers.Informers() {
+		if informer.HasSynced() {
+			informerSynced.WithLabelValues(gvk.String()).Set(1)
+			continue
+		}
+		informerSynced.WithLabelValues(gvk.String()).Set(0)
+		unsynced = append(unsynced, gvk.String())
+	}
+	sort.Strings(unsynced)
+	return unsynced
+}
+
+// InformerSynced reports whether the informer registered for the GVK has synced,
+// a GVK without a registered informer has nothing to wait for.
+func (i *InputResourceInitializer) InformerSynced(gvk schema.GroupVersionKind) bool {
+	informer, ok := i.informers.Informer(gvk)
+	return !ok || informer.HasSynced()
+}
+
+// recordDeletedObject remembers the last known state of a deleted input resource for the operators,
+// until they take it with takeDeletedObjects.
+func (i *InputResourceInitializer) recordDeletedObject(operators []string, gvk schema.GroupVersionKind, obj client.Object) {
+	i.deletedLock.Lock()
+	defer i.deletedLock.Unlock()
+
+	for _, operator := range operators {
+		i.deletedObjects[operator] = append(i.deletedObjects[operator], deletedObject{gvk: gvk, obj: obj})
+	}
+}
+
+// takeDeletedObjects returns the input resources deleted since the operator was last reconciled, in the order of deletion.
+func (i *InputResourceInitializer) takeDeletedObjects(operator string) []deletedObject {
+	i.deletedLock.Lock()
+	defer i.deletedLock.Unlock()
+
+	deleted := i.deletedObjects[operator]
+	delete(i.deletedObjects, operator)
+	return deleted
+}
+
+// withOperator returns a copy of the input resources with the operator's resources added, an empty name adds nothing.
+func withOperator(inputResources map[string]*libraryinputresources.InputResources, name string, resources *libraryinputresources.InputResources) map[string]*libraryinputresources.InputResources {
+	result := make(map[string]*libraryinputresources.InputResources, len(inputResources)+1)
+	for operator, operatorResources := range inputResources {
+		result[operator] = operatorResources
+	}
+	if name != "" {
+		result[name] = resources
+	}
+	return result
+}
+
+// replayCachedObjectsFor passes the objects already held by the informer for the GVK through the dispatcher,
+// since the informer won't deliver them again for filters added after it had synced.
+func (i *InputResourceInitializer) replayCachedObjectsFor(ctx context.Context, gvk schema.GroupVersionKind) error {
+	list, err := newObjectListFor(i.scheme, gvk, i.objectOptions)
+	if err != nil {
+		return err
+	}
+	if err := i.cluster.Cache.List(ctx, list); err != nil {
+		return err
+	}
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		i.dispatcher.Handle(gvk, obj)
+	}
+	return nil
+}
+
+// startAndWaitForInformersFor registers an informer for every kind referenced by the input resources and waits for them to sync.
+// Up to informerStartupConcurrency informers are registered at once, the registry makes sure that
+// a kind shared by several operators is only registered once.
+// A resource that fails to resolve or register doesn't stop the others from being registered,
+// all failures are returned together once the registered informers have synced.
+// It returns the context's error as soon as the context is done.
+func (i *InputResourceInitializer) startAndWaitForInformersFor(ctx context.Context, inputResources map[string]*libraryinputresources.InputResources) error {
+	var (
+		// progressLock guards the errors and the progress of every operator
+		progressLock sync.Mutex
+		errs         []error
+		pending      = map[string]int{}
+		failed       = sets.New[string]()
+	)
+	for operator, resources := range inputResources {
+		pending[operator] = len(inputResourceTypeIdentifiers(resources))
+		if pending[operator] == 0 {
+			i.markOperatorSynced(operator)
+		}
+	}
+	g := &errgroup.Group{}
+	g.SetLimit(i.informerStartupConcurrency)
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		for _, id := range inputResourceTypeIdentifiers(inputResources[operator]) {
+			select {
+			case <-ctx.Done():
+				_ = g.Wait()
+				return ctx.Err()
+			default:
+			}
+			g.Go(func() error {
+				err := i.startInformerFor(ctx, operator, gvrFor(id))
+
+				progressLock.Lock()
+				defer progressLock.Unlock()
+				var notSynced *informerSyncTimeoutError
+				switch {
+				case errors.As(err, &notSynced):
+					// the operator is marked synced once the informer synced in the background
+					failed.Insert(operator)
+				case err != nil:
+					errs = append(errs, fmt.Errorf("operator %q: %s: %w", operator, gvrFor(id), err))
+					failed.Insert(operator)
+				}
+				// the informers are registered blocking until they synced,
+				// so the operator is synced once all of its informers have been registered
+				pending[operator]--
+				if pending[operator] == 0 && !failed.Has(operator) {
+					i.markOperatorSynced(operator)
+				}
+				return nil
+			})
+		}
+	}
+	_ = g.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if i.tolerantPartialSync {
+		// waiting for the whole cache would wait for the informers that didn't sync as well,
+		// the others have been waited for while they were registered
+		if unsynced := i.UnsyncedInformers(); len(unsynced) > 0 {
+			i.log.Info("warning: continuing without the informers that haven't synced, they keep syncing in the background", "gvks", unsynced)
+		}
+		return utilerrors.NewAggregate(errs)
+	}
+	if !i.cluster.Cache.WaitForCacheSync(ctx) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("cache did not sync"))
+	} else {
+		for _, gvk := range i.informers.GVKs() {
+			informerSynced.WithLabelValues(gvk.String()).Set(1)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (i *InputResourceInitializer) startInformerFor(ctx context.Context, operator string, gvr schema.GroupVersionResource) error {
+	gvk, err := i.cluster.Mapper.KindFor(gvr)
+	if err != nil {
+		return err
+	}
+	unlock := i.informers.LockGVK(gvk)
+	defer unlock()
+	if !i.informers.Add(operator, gvk) {
+		return nil
+	}
+	obj, err := newObjectFor(i.scheme, gvk, i.objectOptions)
+	if err != nil {
+		i.informers.Remove(operator, gvk)
+		return err
+	}
+	i.recordUnstructuredFallback(gvk, obj)
+	informerSynced.WithLabelValues(gvk.String()).Set(0)
+	informer, err := i.cluster.Cache.GetInformer(ctx, obj, cache.BlockUntilSynced(!i.tolerantPartialSync))
+	if err != nil {
+		i.informers.Remove(operator, gvk)
+		informerSynced.DeleteLabelValues(gvk.String())
+		return err
+	}
+	i.setWatchErrorHandler(gvk.String(), informer)
+	if i.eventHandlerStagger > 0 {
+		// the handler replays the informer's store once added, spread the replays of the informers out
+		select {
+		case <-ctx.Done():
+			i.informers.Remove(operator, gvk)
+			informerSynced.DeleteLabelValues(gvk.String())
+			return ctx.Err()
+		case <-time.After(wait.Jitter(i.eventHandlerStagger, 1) - i.eventHandlerStagger):
+		}
+	}
+	handler, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			i.dispatcher.Handle(gvk, obj)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			i.dispatcher.Handle(gvk, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			i.dispatcher.HandleDelete(gvk, obj)
+		},
+	})
+	if err != nil {
+		i.informers.Remove(operator, gvk)
+		informerSynced.DeleteLabelValues(gvk.String())
+		return err
+	}
+	i.informers.SetHandler(gvk, informer, handler)
+	i.log.Info("registered informer", "operator", operator, "gvk", gvk.String())
+	if i.tolerantPartialSync {
+		return i.waitForInformerSync(ctx, gvk, informer)
+	}
+	return nil
+}
+
+// recordUnstructuredFallback records that the GVK is read as unstructured objects in the typed mode, since its type isn't registered
+// in the scheme, and warns the first time it does. Strict typed mode fails instead, see ObjectOptions.UnstructuredFallback.
+func (i *InputResourceInitializer) recordUnstructuredFallback(gvk schema.GroupVersionKind, obj client.Object) {
+	if _, ok := obj.(*unstructured.Unstructured); !ok || i.objectOptions.Mode == UnstructuredCacheObjectMode {
+		return
+	}
+
+	i.fallbacksLock.Lock()
+	defer i.fallbacksLock.Unlock()
+
+	if i.unstructuredFallbacks.Has(gvk.String()) {
+		return
+	}
+	i.unstructuredFallbacks.Insert(gvk.String())
+	i.log.Info("warning: the type isn't registered in the scheme, reading it as unstructured objects", "gvk", gvk.String())
+}
+
+// UnstructuredFallbacks returns the sorted GVKs read as unstructured objects in the typed mode,
+// since their types aren't registered in the scheme.
+func (i *InputResourceInitializer) UnstructuredFallbacks() []string {
+	i.fallbacksLock.Lock()
+	defer i.fallbacksLock.Unlock()
+
+	return sets.List(i.unstructuredFallbacks)
+}
+
+// partialSyncTimeout is how long an informer is waited for to sync when partial syncs are tolerated.
+const partialSyncTimeout = 2 * time.Minute
+
+// informerSyncTimeoutError reports that an informer didn't sync within partialSyncTimeout.
+type informerSyncTimeoutError struct {
+	gvk schema.GroupVersionKind
+}
+
+func (e *informerSyncTimeoutError) Error() string {
+	return fmt.Sprintf("informer for %s did not sync within %s", e.gvk, partialSyncTimeout)
+}
+
+// waitForInformerSync waits up to partialSyncTimeout for the informer to sync.
+// When it doesn't, it returns an informerSyncTimeoutError and keeps waiting in the background,
+// the informer itself keeps retrying to list and watch its kind.
+func (i *InputResourceInitializer) waitForInformerSync(ctx context.Context, gvk schema.GroupVersionKind, informer cache.Informer) error {
+	syncCtx, cancel := context.WithTimeout(ctx, partialSyncTimeout)
+	defer cancel()
+	err := wait.PollUntilContextCancel(syncCtx, 100*time.Millisecond, true, func(context.Context) (bool, error) {
+		return informer.HasSynced(), nil
+	})
+	if err == nil {
+		informerSynced.WithLabelValues(gvk.String()).Set(1)
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	i.log.Info("warning: informer did not sync in time, continuing without it", "gvk", gvk.String(), "timeout", partialSyncTimeout)
+	go i.awaitInformerSync(ctx, gvk, informer)
+	return &informerSyncTimeoutError{gvk: gvk}
+}
+
+// awaitInformerSync waits for an informer that didn't sync in time, until it syncs or is removed,
+// and marks the operators referencing it as synced once all of their informers synced.
+func (i *InputResourceInitializer) awaitInformerSync(ctx context.Context, gvk schema.GroupVersionKind, informer cache.Informer) {
+	err := wait.PollUntilContextCancel(ctx, time.Second, false, func(context.Context) (bool, error) {
+		if _, ok := i.informers.Informer(gvk); !ok {
+			return false, fmt.Errorf("informer for %s was removed", gvk)
+		}
+		return informer.HasSynced(), nil
+	})
+	if err != nil {
+		return
+	}
+	informerSynced.WithLabelValues(gvk.String()).Set(1)
+	i.log.Info("informer synced in the background", "gvk", gvk.String())
+	for _, operator := range i.informers.Operators(gvk) {
+		if i.operatorInformersSynced(operator) {
+			i.markOperatorSynced(operator)
+		}
+	}
+}
+
+// operatorInformersSynced reports whether all informers referenced by the operator have synced.
+func (i *InputResourceInitializer) operatorInformersSynced(operator string) bool {
+	for _, gvk := range i.informers.GVKs() {
+		if sets.New(i.informers.Operators(gvk)...).Has(operator) && !i.InformerSynced(gvk) {
+			return false
+		}
+	}
+	return true
+}
+
+// releaseInformerFor drops the operator's reference to the GVK and,
+// when no other operator needs it anymore, removes its informer from the cache.
+func (i *InputResourceInitializer) releaseInformerFor(ctx context.Context, operator string, gvk schema.GroupVersionKind) error {
+	if !i.informers.Remove(operator, gvk) {
+		return nil
+	}
+
+	obj, err := newObjectFor(i.scheme, gvk, i.objectOptions)
+	if err != nil {
+		return err
+	}
+	if handler, ok := i.informers.TakeHandler(gvk); ok {
+		informer, err := i.cluster.Cache.GetInformer(ctx, obj, cache.BlockUntilSynced(false))
+		if err != nil {
+			return err
+		}
+		if err := informer.RemoveEventHandler(handler); err != nil {
+			return err
+		}
+	}
+	if err := i.cluster.Cache.RemoveInformer(ctx, obj); err != nil {
+		return err
+	}
+	informerSynced.DeleteLabelValues(gvk.String())
+	i.log.Info("removed informer", "operator", operator, "gvk", gvk.String())
+	return nil
+}
+
+// checkSupportedInputResources verifies that every resource referenced by the input resources
+// is served by the cluster and can be listed and watched.
+// All unsupported resources are reported, not only the first one.
+func checkSupportedInputResources(discoveryClient discovery.DiscoveryInterface, inputResources map[string]*libraryinputresources.InputResources) error {
+	type groupVersionResources struct {
+		resources *metav1.APIResourceList
+		err       error
+	}
+	servedResources := map[schema.GroupVersion]groupVersionResources{}
+
+	var errs []error
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		for _, id := range inputResourceTypeIdentifiers(inputResources[operator]) {
+			gvr := gvrFor(id)
+			served, ok := servedResources[gvr.GroupVersion()]
+			if !ok {
+				served.resources, served.err = discoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+				servedResources[gvr.GroupVersion()] = served
+			}
+			if served.err != nil {
+				errs = append(errs, fmt.Errorf("operator %q: unable to discover %s: %w", operator, gvr, served.err))
+				continue
+			}
+
+			var resource *metav1.APIResource
+			for idx := range served.resources.APIResources {
+				if served.resources.APIResources[idx].Name == gvr.Resource {
+					resource = &served.resources.APIResources[idx]
+					break
+				}
+			}
+			if resource == nil {
+				errs = append(errs, fmt.Errorf("operator %q: %s is not served by the cluster", operator, gvr))
+				continue
+			}
+			verbs := sets.New[string](resource.Verbs...)
+			if !verbs.HasAll("list", "watch") {
+				errs = append(errs, fmt.Errorf("operator %q: %s (namespaced=%v) doesn't support list and watch, supported verbs: %v", operator, gvr, resource.Namespaced, sets.List(verbs)))
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,170 @@
+package dynamiccache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clientgotesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSyncInputResourcesCancelledDuringBackoff(t *testing.T) {
+	// the input resources are invalid, so that every sync attempt fails right away and is retried after the backoff
+	i := NewInputResourceInitializer(InputResourceInitializerOptions{
+		Log: logr.Discard(),
+		Cluster: InputResourceCluster{
+			Name:   "isolated",
+			Mapper: testMapper(),
+			InputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "", "ns", "config")}),
+			},
+			Isolated: true,
+		},
+	})
+	i.syncDelay = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- i.syncInputResources(ctx)
+	}()
+	// the first retry is only due after a second
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a shutdown not to be reported as a failed sync, got %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expected the sync to return once the context is done, it is still waiting for the backoff")
+	}
+	if i.HasSynced() {
+		t.Error("expected the input resources not to be synced")
+	}
+}
+
+func TestStartCancelledDuringSyncDelay(t *testing.T) {
+	i := NewInputResourceInitializer(InputResourceInitializerOptions{
+		Log:     logr.Discard(),
+		Cluster: InputResourceCluster{Name: "cluster", Mapper: testMapper()},
+	})
+	i.syncDelay = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- i.start(ctx)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the context's error, got %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("expected the sync to return once the context is done, it is still waiting for the delay")
+	}
+}
+
+func TestMarkSyncedClosesOnce(t *testing.T) {
+	i := NewInputResourceInitializer(InputResourceInitializerOptions{
+		Log:     logr.Discard(),
+		Cluster: InputResourceCluster{Name: "cluster", Mapper: testMapper()},
+	})
+	if i.HasSynced() {
+		t.Fatal("expected the initializer not to be synced before the sync")
+	}
+	select {
+	case <-i.Synced():
+		t.Fatal("expected the synced channel to be open before the sync")
+	default:
+	}
+
+	// a retried sync and concurrent callers mark it synced several times, closing the channel twice would panic
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			i.markSynced()
+		}()
+	}
+	wg.Wait()
+	i.markSynced()
+
+	if !i.HasSynced() {
+		t.Error("expected the initializer to be synced")
+	}
+	select {
+	case <-i.Synced():
+	default:
+		t.Error("expected the synced channel to be closed")
+	}
+}
+
+// failingListCache is a synced cache whose lists fail, it has no other behaviour.
+type failingListCache struct {
+	cache.Cache
+	err error
+}
+
+func (c *failingListCache) WaitForCacheSync(_ context.Context) bool {
+	return true
+}
+
+func (c *failingListCache) List(_ context.Context, _ client.ObjectList, _ ...client.ListOption) error {
+	return c.err
+}
+
+func TestAddOperatorReplayFailure(t *testing.T) {
+	errReplay := errors.New("replay failed")
+	a := applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "a")})
+	i := NewInputResourceInitializer(InputResourceInitializerOptions{
+		Log: logr.Discard(),
+		Cluster: InputResourceCluster{
+			Name:           "cluster",
+			Cache:          &failingListCache{err: errReplay},
+			Mapper:         testMapper(),
+			InputResources: map[string]*libraryinputresources.InputResources{"a": a},
+		},
+		Discovery: &fakediscovery.FakeDiscovery{Fake: &clientgotesting.Fake{Resources: []*metav1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "configmaps", Namespaced: true, Kind: "ConfigMap", Verbs: metav1.Verbs{"list", "watch"}}},
+		}}}},
+		Scheme: clientgoscheme.Scheme,
+	})
+	// operator a observes the configmaps already, so that the objects cached for them are replayed for operator b
+	i.inputResources["a"] = a
+	i.informers.Add("a", configMapGVK)
+	i.publish(i.inputResources)
+	i.markSynced()
+
+	err := i.AddOperator(context.Background(), "b", applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "b")}))
+	if !errors.Is(err, errReplay) {
+		t.Fatalf("expected the replay error, got %v", err)
+	}
+	if _, ok := i.inputResources["b"]; ok {
+		t.Error("expected operator b not to be observed")
+	}
+	if _, ok := i.InputResources()["b"]; ok {
+		t.Error("expected operator b not to be published")
+	}
+	if _, ok := i.dispatcher.FilterCriteria()["b"]; ok {
+		t.Error("expected the filters of operator b to be removed")
+	}
+	if operators := i.informers.Operators(configMapGVK); len(operators) != 1 || operators[0] != "a" {
+		t.Errorf("expected the informer of the configmaps to be held by operator a only, got %v", operators)
+	}
+}
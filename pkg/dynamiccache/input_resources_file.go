@@ -0,0 +1,148 @@
+package dynamiccache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadInputResourcesFile reads the input resources keyed by the operator name from a YAML or JSON file
+// and validates them. Errors are returned as an InputResourcesSourceError.
+func LoadInputResourcesFile(path string) (map[string]*libraryinputresources.InputResources, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewInputResourcesSourceError(FileInputResourcesSource, path, err)
+	}
+	inputResources := map[string]*libraryinputresources.InputResources{}
+	if err := yaml.UnmarshalStrict(data, &inputResources); err != nil {
+		return nil, NewInputResourcesSourceError(FileInputResourcesSource, path, fmt.Errorf("failed to parse: %w", err))
+	}
+	if err := validateInputResources(inputResources, nil); err != nil {
+		return nil, NewInputResourcesSourceError(FileInputResourcesSource, path, fmt.Errorf("invalid input resources: %w", err))
+	}
+	return inputResources, nil
+}
+
+// inputResourcesDirFileNames are the names of the file holding the input resources of an operator in an input resources directory.
+var inputResourcesDirFileNames = []string{"input-resources.yaml", "input-resources.yml", "input-resources.json"}
+
+// LoadInputResourcesDir reads the input resources of every operator from a directory tree,
+// as written by the input-resources command of the multi-operator-manager:
+// every subdirectory holds the input resources of the operator it is named after, as a single InputResources document
+// in one of inputResourcesDirFileNames. Other files, and subdirectories without such a file, are skipped.
+// The loaded and skipped operators are logged. Errors are returned as an InputResourcesSourceError.
+func LoadInputResourcesDir(log logr.Logger, dir string) (map[string]*libraryinputresources.InputResources, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, NewInputResourcesSourceError(DirInputResourcesSource, dir, err)
+	}
+	inputResources := map[string]*libraryinputresources.InputResources{}
+	var skipped []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		operator := entry.Name()
+		var found []string
+		for _, name := range inputResourcesDirFileNames {
+			if _, err := os.Stat(filepath.Join(dir, operator, name)); err == nil {
+				found = append(found, name)
+			}
+		}
+		switch len(found) {
+		case 0:
+			skipped = append(skipped, operator)
+			continue
+		case 1:
+		default:
+			return nil, NewInputResourcesSourceError(DirInputResourcesSource, filepath.Join(dir, operator), fmt.Errorf("operator %q has several input resources files %v, keep only one", operator, found))
+		}
+		path := filepath.Join(dir, operator, found[0])
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, NewInputResourcesSourceError(DirInputResourcesSource, path, err)
+		}
+		resources := &libraryinputresources.InputResources{}
+		if err := yaml.UnmarshalStrict(data, resources); err != nil {
+			return nil, NewInputResourcesSourceError(DirInputResourcesSource, path, fmt.Errorf("failed to parse: %w", err))
+		}
+		inputResources[operator] = resources
+	}
+	if err := validateInputResources(inputResources, nil); err != nil {
+		return nil, NewInputResourcesSourceError(DirInputResourcesSource, dir, fmt.Errorf("invalid input resources: %w", err))
+	}
+	log.Info("loaded the input resources from the directory", "dir", dir, "operators", sets.List(sets.KeySet(inputResources)), "skipped", skipped)
+	return inputResources, nil
+}
+
+// sourceErrorDetails returns the key and value pairs describing an InputResourcesSourceError, if err wraps one.
+func sourceErrorDetails(err error) []interface{} {
+	var sourceErr *InputResourcesSourceError
+	if !errors.As(err, &sourceErr) {
+		return nil
+	}
+	return []interface{}{"source", sourceErr.Kind, "ref", sourceErr.Ref, "line", sourceErr.Line, "hint", sourceErr.Hint}
+}
+
+// InputResourceReloader loads the input resources again on every SIGHUP and applies them.
+// SIGTERM and SIGINT are left to ctrl.SetupSignalHandler.
+type InputResourceReloader struct {
+	log    logr.Logger
+	load   func() (map[string]*libraryinputresources.InputResources, error)
+	reload func(ctx context.Context, inputResources map[string]*libraryinputresources.InputResources) error
+}
+
+// InputResourceReloaderOptions configures an InputResourceReloader.
+type InputResourceReloaderOptions struct {
+	Log logr.Logger
+	// Load returns the current input resources, keyed by the operator name.
+	Load func() (map[string]*libraryinputresources.InputResources, error)
+	// Reload applies the loaded input resources, e.g. DynamicReconciler.Reload.
+	Reload func(ctx context.Context, inputResources map[string]*libraryinputresources.InputResources) error
+}
+
+func NewInputResourceReloader(opts InputResourceReloaderOptions) *InputResourceReloader {
+	return &InputResourceReloader{log: opts.Log, load: opts.Load, reload: opts.Reload}
+}
+
+var _ manager.LeaderElectionRunnable = (*InputResourceReloader)(nil)
+
+// NeedLeaderElection makes the reloader run along the initializers, on the leader only.
+func (r *InputResourceReloader) NeedLeaderElection() bool {
+	return true
+}
+
+func (r *InputResourceReloader) Start(ctx context.Context) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-signals:
+		}
+		r.log.Info("reloading the input resources")
+		inputResources, err := r.load()
+		if err != nil {
+			r.log.Error(err, "failed to load the input resources, keeping the previous ones", sourceErrorDetails(err)...)
+			continue
+		}
+		if err := r.reload(ctx, inputResources); err != nil {
+			r.log.Error(err, "failed to reload the input resources")
+			continue
+		}
+		r.log.Info("reloaded the input resources", "operators", len(inputResources))
+	}
+}
@@ -0,0 +1,68 @@
+package dynamiccache
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strconv"
+)
+
+// InputResourcesSourceKind is the kind of source input resources are loaded from.
+type InputResourcesSourceKind string
+
+const (
+	// FileInputResourcesSource loads the input resources from a YAML or JSON file, see LoadInputResourcesFile.
+	FileInputResourcesSource InputResourcesSourceKind = "file"
+	// DirInputResourcesSource loads the input resources from a directory per operator, see LoadInputResourcesDir.
+	DirInputResourcesSource InputResourcesSourceKind = "dir"
+)
+
+// InputResourcesSourceError reports input resources that couldn't be loaded from a source,
+// with enough details for the user to fix the source.
+type InputResourcesSourceError struct {
+	Kind InputResourcesSourceKind
+	// Ref identifies the source, e.g. the path of a file.
+	Ref string
+	// Line is the line of the source the error was found at, zero when unknown.
+	Line int
+	// Hint tells the user how to fix the source.
+	Hint string
+	Err  error
+}
+
+// yamlLineRE extracts the line from the errors of the YAML parser, e.g. "yaml: line 3: mapping values are not allowed".
+var yamlLineRE = regexp.MustCompile(`line (\d+)`)
+
+// NewInputResourcesSourceError wraps an error loading the input resources from the source,
+// so that all sources report their errors the same way.
+// The line is taken from the error when it names one, the hint is derived from the error and can be overridden.
+func NewInputResourcesSourceError(kind InputResourcesSourceKind, ref string, err error) *InputResourcesSourceError {
+	sourceErr := &InputResourcesSourceError{Kind: kind, Ref: ref, Err: err}
+	if match := yamlLineRE.FindStringSubmatch(err.Error()); match != nil {
+		sourceErr.Line, _ = strconv.Atoi(match[1])
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		sourceErr.Hint = "check that the path is correct and the file is mounted"
+	case errors.Is(err, fs.ErrPermission):
+		sourceErr.Hint = "make the file readable by the process"
+	case sourceErr.Line > 0:
+		sourceErr.Hint = fmt.Sprintf("fix the syntax around line %d", sourceErr.Line)
+	default:
+		sourceErr.Hint = "fix the input resources listed in the error"
+	}
+	return sourceErr
+}
+
+func (e *InputResourcesSourceError) Error() string {
+	location := fmt.Sprintf("%s %q", e.Kind, e.Ref)
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s, line %d", location, e.Line)
+	}
+	return fmt.Sprintf("failed to load the input resources from %s: %v (hint: %s)", location, e.Err, e.Hint)
+}
+
+func (e *InputResourcesSourceError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,88 @@
+package dynamiccache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	dispatchedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_dispatched_events_total",
+		Help: "Number of informer events that matched a filter and were dispatched to the controller.",
+	}, []string{"gvk"})
+
+	matchedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_matched_events_total",
+		Help: "Number of dispatched informer events by the category of the resource list whose filters matched them. An event matching several categories is counted once per category.",
+	}, []string{"gvk", "category"})
+
+	filteredEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_filtered_events_total",
+		Help: "Number of informer events that didn't match any filter.",
+	}, []string{"gvk"})
+
+	unfilteredEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_unfiltered_events_total",
+		Help: "Number of events handled for a GVK no operator has filters for. They indicate that the registered informers and the filters got out of sync, events filtered out by existing filters aren't counted.",
+	}, []string{"gvk"})
+
+	droppedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_dropped_events_total",
+		Help: "Number of informer events that couldn't be dispatched.",
+	}, []string{"gvk"})
+
+	coalescedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_coalesced_events_total",
+		Help: "Number of informer events replaced by a later event of the same object while it was rate limited.",
+	}, []string{"gvk"})
+
+	reconcileDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dynamiccache_reconcile_duration_seconds",
+		Help:    "Time taken by the DynamicReconciler to read the input resources of an operator, including a failed read.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"operator"})
+
+	inputResourceReadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_input_resource_reads_total",
+		Help: "Number of input resources read by the DynamicReconciler by outcome: found, notfound or error. A label selected resource is found when the list isn't empty.",
+	}, []string{"operator", "outcome"})
+
+	operatorLastEventTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dynamiccache_operator_last_event_timestamp_seconds",
+		Help: "Unix time of the last event dispatched to the controller for an operator whose filters matched it. An operator not seeing any event for long can indicate a stuck informer.",
+	}, []string{"operator"})
+
+	informerSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dynamiccache_informer_synced",
+		Help: "Whether the informer for a GVK has synced (1) or not (0).",
+	}, []string{"gvk"})
+
+	watchErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dynamiccache_watch_errors_total",
+		Help: "Number of watches of the informers dropped with an error, by cluster and type. The type is the GVK for handlers set per informer, and the type description of the reflector for the cache-wide handler. A steadily growing count indicates a flapping watch.",
+	}, []string{"cluster", "type"})
+
+	operatorSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dynamiccache_operator_synced",
+		Help: "Whether the informers of all input resources of an operator have synced (1) or not (0).",
+	}, []string{"cluster", "operator"})
+)
+
+// RegisterMetrics exposes the dynamic cache metrics on the controller-runtime metrics endpoint.
+// The metrics are updated regardless, they are only served once registered.
+func RegisterMetrics() {
+	metrics.Registry.MustRegister(
+		dispatchedEventsTotal,
+		matchedEventsTotal,
+		filteredEventsTotal,
+		unfilteredEventsTotal,
+		droppedEventsTotal,
+		coalescedEventsTotal,
+		reconcileDurationSeconds,
+		inputResourceReadsTotal,
+		operatorLastEventTimestampSeconds,
+		informerSynced,
+		operatorSynced,
+		watchErrorsTotal,
+	)
+}
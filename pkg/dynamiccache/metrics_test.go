@@ -0,0 +1,66 @@
+package dynamiccache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache/dynamiccachetest"
+)
+
+func TestReconcileMetrics(t *testing.T) {
+	// the metrics are global, the operator is only reconciled by this test
+	const operator = "metrics"
+	c, err := dynamiccachetest.NewCache(clientgoscheme.Scheme, configMap("ns", "found"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.InjectGetError(configMapGVK, client.ObjectKey{Namespace: "ns", Name: "broken"}, errBoom)
+	r := &dynamiccache.DynamicReconciler{
+		Log:    logr.Discard(),
+		Mapper: testMapper(),
+		Scheme: clientgoscheme.Scheme,
+		Cache:  c,
+		InputResources: map[string]*libraryinputresources.InputResources{
+			// the reads stop at the first error, the broken resource comes last
+			operator: applyConfigurationResources([]libraryinputresources.ExactResourceID{
+				exactConfigMap("ns", "found"),
+				exactConfigMap("ns", "missing"),
+				exactConfigMap("ns", "broken"),
+			}),
+		},
+	}
+
+	for range 2 {
+		if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Name: operator}}); err == nil {
+			t.Fatal("expected the injected error to be returned")
+		}
+	}
+
+	for outcome, want := range map[string]float64{"found": 2, "notfound": 2, "error": 2} {
+		if got := testutil.ToFloat64(dynamiccache.InputResourceReadsTotal.WithLabelValues(operator, outcome)); got != want {
+			t.Errorf("expected %v reads with the outcome %s, got %v", want, outcome, got)
+		}
+	}
+	if got := reconcileDurationSampleCount(t, operator); got != 2 {
+		t.Errorf("expected the duration of 2 reconciles to be observed, got %d", got)
+	}
+}
+
+func reconcileDurationSampleCount(t *testing.T, operator string) uint64 {
+	t.Helper()
+	m := &dto.Metric{}
+	if err := dynamiccache.ReconcileDurationSeconds.WithLabelValues(operator).(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
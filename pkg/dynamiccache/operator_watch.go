@@ -0,0 +1,187 @@
+package dynamiccache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OperatorInputResourcesFunc extracts the input resources from the CR representing an operator.
+type OperatorInputResourcesFunc func(obj *unstructured.Unstructured) (*libraryinputresources.InputResources, error)
+
+// DefaultOperatorInputResourcesField is the field of the operator CRs InputResourcesFromField is used with by default.
+const DefaultOperatorInputResourcesField = "spec.inputResources"
+
+// InputResourcesFromField returns an OperatorInputResourcesFunc decoding the input resources
+// from the field of the CR at the dot separated path, e.g. spec.inputResources.
+// A CR without the field declares no input resources.
+func InputResourcesFromField(path string) OperatorInputResourcesFunc {
+	fields := strings.Split(path, ".")
+	return func(obj *unstructured.Unstructured) (*libraryinputresources.InputResources, error) {
+		content, found, err := unstructured.NestedMap(obj.Object, fields...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+		resources := &libraryinputresources.InputResources{}
+		if !found {
+			return resources, nil
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(content, resources, true); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", path, err)
+		}
+		return resources, nil
+	}
+}
+
+// OperatorWatch configures the CRs representing the operators, the input resources of every CR are observed
+// as those of an operator named after the CR, <namespace>/<name> for namespaced CRs.
+type OperatorWatch struct {
+	// GVK is the kind of the operator CRs, they are read as unstructured objects.
+	GVK schema.GroupVersionKind
+	// InputResources extracts the input resources from a CR,
+	// defaults to InputResourcesFromField with the DefaultOperatorInputResourcesField.
+	InputResources OperatorInputResourcesFunc
+}
+
+func (w *OperatorWatch) inputResourcesFor(obj *unstructured.Unstructured) (*libraryinputresources.InputResources, error) {
+	if w.InputResources == nil {
+		return InputResourcesFromField(DefaultOperatorInputResourcesField)(obj)
+	}
+	return w.InputResources(obj)
+}
+
+// watchOperators starts watching the operator CRs, the operators are added, changed and removed
+// along their CRs by a single worker until the context is done.
+// It is called once the initial sync completed, since operators can only be added from then on.
+func (i *InputResourceInitializer) watchOperators(ctx context.Context) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(i.operatorWatch.GVK)
+	informer, err := i.cluster.Cache.GetInformer(ctx, obj, cache.BlockUntilSynced(true))
+	if err != nil {
+		return fmt.Errorf("unable to watch the operator CRs of %s: %w", i.operatorWatch.GVK, err)
+	}
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	enqueue := func(obj interface{}) {
+		key, err := toolscache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			i.log.Error(err, "failed to get the key of the operator CR")
+			return
+		}
+		queue.Add(key)
+	}
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, newObj interface{}) { enqueue(newObj) },
+		DeleteFunc: enqueue,
+	}); err != nil {
+		queue.ShutDown()
+		return err
+	}
+	i.log.Info("watching the operator CRs", "gvk", i.operatorWatch.GVK.String())
+
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+	go func() {
+		for i.processNextOperatorCR(ctx, queue) {
+		}
+	}()
+	return nil
+}
+
+func (i *InputResourceInitializer) processNextOperatorCR(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string]) bool {
+	operator, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(operator)
+
+	if err := i.syncOperatorCR(ctx, operator); err != nil {
+		i.log.Error(err, "failed to sync the operator CR, retrying", "operator", operator)
+		queue.AddRateLimited(operator)
+		return true
+	}
+	queue.Forget(operator)
+	return true
+}
+
+// syncOperatorCR makes the observed input resources of the operator match its CR.
+// Operators declared by the input resources passed to the initializer are left alone,
+// a CR named like one of them is reported and ignored.
+func (i *InputResourceInitializer) syncOperatorCR(ctx context.Context, operator string) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(i.operatorWatch.GVK)
+	id := operatorIdentityFor(operator)
+	err := i.cluster.Cache.Get(ctx, client.ObjectKey{Namespace: id.Namespace, Name: id.Name}, obj)
+	if apierrors.IsNotFound(err) {
+		if !i.isWatchedOperator(operator) {
+			return nil
+		}
+		if err := i.RemoveOperator(ctx, operator); err != nil {
+			return err
+		}
+		i.setWatchedOperator(operator, false)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	resources, err := i.operatorWatch.inputResourcesFor(obj)
+	if err != nil {
+		// retrying won't help until the CR is fixed, which requeues it
+		i.log.Error(err, "failed to extract the input resources from the operator CR", "operator", operator)
+		return nil
+	}
+	current, observed := i.InputResources()[operator]
+	if observed && !i.isWatchedOperator(operator) {
+		i.log.Info("warning: ignoring the operator CR, the operator is already declared by the input resources", "operator", operator)
+		return nil
+	}
+	if observed && equality.Semantic.DeepEqual(current, resources) {
+		return nil
+	}
+	if observed {
+		if err := i.RemoveOperator(ctx, operator); err != nil {
+			return err
+		}
+		i.setWatchedOperator(operator, false)
+	}
+	if err := i.AddOperator(ctx, operator, resources); err != nil {
+		return err
+	}
+	i.setWatchedOperator(operator, true)
+	return nil
+}
+
+// isWatchedOperator reports whether the operator was added from its CR.
+func (i *InputResourceInitializer) isWatchedOperator(operator string) bool {
+	i.watchedOperatorsLock.Lock()
+	defer i.watchedOperatorsLock.Unlock()
+
+	return i.watchedOperators.Has(operator)
+}
+
+func (i *InputResourceInitializer) setWatchedOperator(operator string, watched bool) {
+	i.watchedOperatorsLock.Lock()
+	defer i.watchedOperatorsLock.Unlock()
+
+	if watched {
+		i.watchedOperators.Insert(operator)
+		return
+	}
+	i.watchedOperators.Delete(operator)
+}
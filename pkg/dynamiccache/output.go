@@ -0,0 +1,81 @@
+package dynamiccache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// observedResourcePath returns <outputDir>/<operator>/<group>/<kind>/<namespace>_<name>.json,
+// the core group is written as "core" and cluster-scoped objects as <name>.json.
+func observedResourcePath(outputDir, operator string, obj *unstructured.Unstructured) string {
+	gvk := obj.GroupVersionKind()
+	group := gvk.Group
+	if group == "" {
+		group = "core"
+	}
+	fileName := obj.GetName() + ".json"
+	if obj.GetNamespace() != "" {
+		fileName = obj.GetNamespace() + "_" + fileName
+	}
+	return filepath.Join(outputDir, operator, group, gvk.Kind, fileName)
+}
+
+// writeObservedResource writes the object as indented JSON to its observedResourcePath.
+// The file is replaced atomically, so readers never see a partial write,
+// and is left untouched when the object didn't change since it was last written.
+// It reports whether the file was written.
+func writeObservedResource(outputDir, operator string, obj *unstructured.Unstructured) (bool, error) {
+	data, err := json.MarshalIndent(obj.Object, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	path := observedResourcePath(outputDir, operator, obj)
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil && bytes.Equal(existing, data):
+		return false, nil
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeObservedResource removes the file written for the object by writeObservedResource.
+// It reports whether there was a file to remove.
+func removeObservedResource(outputDir, operator string, obj *unstructured.Unstructured) (bool, error) {
+	err := os.Remove(observedResourcePath(outputDir, operator, obj))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	default:
+		return false, err
+	}
+}
@@ -0,0 +1,82 @@
+package dynamiccache_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	corev1 "k8s.io/api/core/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache/dynamiccachetest"
+)
+
+// TestConcurrentUpdatesAndReconciles updates an object in place right after dispatching it, the way the store of an informer
+// holds on to the objects it hands out, while the dispatched objects are read and reconciled concurrently.
+// It is meant to be run with -race, the dispatcher must hand out copies for the reads not to race with the updates.
+func TestConcurrentUpdatesAndReconciles(t *testing.T) {
+	inputResources := map[string]*libraryinputresources.InputResources{
+		"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactConfigMap("ns", "config")}),
+	}
+	h := newTestHarness(t, inputResources)
+	c, err := dynamiccachetest.NewCache(clientgoscheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &dynamiccache.DynamicReconciler{
+		Log:            logr.Discard(),
+		Mapper:         testMapper(),
+		Scheme:         clientgoscheme.Scheme,
+		Cache:          c,
+		InputResources: inputResources,
+	}
+
+	const updates = 200
+	dispatched := make(chan client.Object, updates)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(dispatched)
+
+		obj := configMap("ns", "config")
+		obj.Data = map[string]string{}
+		for i := range updates {
+			obj.ResourceVersion = strconv.Itoa(i)
+			obj.Data["update"] = strconv.Itoa(i)
+			if err := c.Add(obj); err != nil {
+				t.Error(err)
+				return
+			}
+			e, ok := h.Handle(configMapGVK, obj)
+			if !ok {
+				t.Errorf("expected an event for the update %d", i)
+				return
+			}
+			dispatched <- e.Object
+		}
+	}()
+
+	// several workers, an operator is still never reconciled twice at once
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range dispatched {
+				if data := obj.(*corev1.ConfigMap).Data["update"]; data != obj.GetResourceVersion() {
+					t.Errorf("expected the dispatched object to be a consistent copy, got the update %s at the resourceVersion %s", data, obj.GetResourceVersion())
+				}
+				if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "a"}}); err != nil {
+					t.Errorf("unexpected reconcile error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
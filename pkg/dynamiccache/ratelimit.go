@@ -0,0 +1,132 @@
+package dynamiccache
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// minObjectLimiterSweep is the number of tracked objects below which idle limiters aren't swept.
+const minObjectLimiterSweep = 1024
+
+type objectLimiterKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	name      string
+}
+
+// objectLimiter is the token bucket of a single object, with the latest event held back while the bucket is empty.
+type objectLimiter struct {
+	limiter *rate.Limiter
+	// pending is the latest event held back, it is sent once the bucket has a token again
+	pending client.Object
+}
+
+// objectRateLimiter limits the events dispatched per object with a token bucket each.
+// Events over the limit aren't dropped but coalesced: the latest one is held back and sent once
+// the bucket has a token again, so that an object changing constantly still reaches the controller at the configured rate.
+// It is safe for concurrent use.
+type objectRateLimiter struct {
+	limit rate.Limit
+	burst int
+	// send dispatches a held back event once the bucket has a token again
+	send func(gvk schema.GroupVersionKind, obj client.Object)
+
+	lock     sync.Mutex
+	limiters map[objectLimiterKey]*objectLimiter
+	sweepAt  int
+}
+
+func newObjectRateLimiter(perSecond float64, burst int, send func(gvk schema.GroupVersionKind, obj client.Object)) *objectRateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &objectRateLimiter{
+		limit:    rate.Limit(perSecond),
+		burst:    burst,
+		send:     send,
+		limiters: map[objectLimiterKey]*objectLimiter{},
+		sweepAt:  minObjectLimiterSweep,
+	}
+}
+
+// Allow reports whether the event can be sent right away.
+// Otherwise the event replaces the one already held back for the object, if any, and is sent later.
+// The object passed is the last known state of deleted objects, the dispatched one may be a DeletedObject.
+func (l *objectRateLimiter) Allow(gvk schema.GroupVersionKind, obj, dispatched client.Object) bool {
+	key := objectLimiterKey{gvk: gvk, namespace: obj.GetNamespace(), name: obj.GetName()}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	limiter, ok := l.limiters[key]
+	if !ok {
+		l.sweep()
+		limiter = &objectLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = limiter
+	}
+	if limiter.pending != nil {
+		limiter.pending = dispatched
+		coalescedEventsTotal.WithLabelValues(gvk.String()).Inc()
+		return false
+	}
+	if limiter.limiter.Allow() {
+		return true
+	}
+	limiter.pending = dispatched
+	time.AfterFunc(limiter.limiter.Reserve().Delay(), func() {
+		l.flush(gvk, key)
+	})
+	return false
+}
+
+// flush sends the event held back for the object.
+func (l *objectRateLimiter) flush(gvk schema.GroupVersionKind, key objectLimiterKey) {
+	l.lock.Lock()
+	limiter, ok := l.limiters[key]
+	if !ok || limiter.pending == nil {
+		l.lock.Unlock()
+		return
+	}
+	pending := limiter.pending
+	limiter.pending = nil
+	l.lock.Unlock()
+
+	l.send(gvk, pending)
+}
+
+// dropPending drops the events held back for all objects, the pending flushes become no-ops.
+// It returns the number of events dropped.
+func (l *objectRateLimiter) dropPending() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	dropped := 0
+	for key, limiter := range l.limiters {
+		if limiter.pending == nil {
+			continue
+		}
+		limiter.pending = nil
+		droppedEventsTotal.WithLabelValues(key.gvk.String()).Inc()
+		dropped++
+	}
+	return dropped
+}
+
+// sweep drops the limiters of the objects that haven't had events for long enough for their bucket to refill,
+// once the number of tracked objects doubled since the last sweep. It must be called with the lock held.
+func (l *objectRateLimiter) sweep() {
+	if len(l.limiters) < l.sweepAt {
+		return
+	}
+	now := time.Now()
+	for key, limiter := range l.limiters {
+		if limiter.pending == nil && limiter.limiter.TokensAt(now) >= float64(l.burst) {
+			delete(l.limiters, key)
+		}
+	}
+	l.sweepAt = max(2*len(l.limiters), minObjectLimiterSweep)
+}
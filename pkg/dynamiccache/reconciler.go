@@ -0,0 +1,751 @@
+package dynamiccache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type DynamicReconciler struct {
+	Log    logr.Logger
+	Mapper meta.RESTMapper
+	Scheme *runtime.Scheme
+	Cache  cache.Cache
+	// APIReader reads the whole exact resources when only their metadata is cached, see MetadataOnlyExact.
+	APIReader client.Reader
+
+	// InputResources are the input resources declared by each operator, keyed by the operator name.
+	// Namespaced operators are keyed as "<namespace>/<name>", see operatorIdentityFor.
+	InputResources map[string]*libraryinputresources.InputResources
+	// InputResourceRefinements narrow down what the InputResources match, keyed by the operator name,
+	// see InputResourceRefinements.
+	InputResourceRefinements map[string]*InputResourceRefinements
+
+	// GuestCluster, when set, is a second cluster observed alongside the management cluster.
+	// The operators declare their input resources on it in GuestInputResources.
+	GuestCluster                  cluster.Cluster
+	GuestInputResources           map[string]*libraryinputresources.InputResources
+	GuestInputResourceRefinements map[string]*InputResourceRefinements
+
+	// OperatorNameFunc returns the operators an observed resource that isn't an exact resource belongs to,
+	// defaults to OperatorNameFromLabel with the DefaultOperatorNameLabel.
+	OperatorNameFunc OperatorNameFunc
+
+	// CacheObjectMode selects whether the input resources are watched and read as typed or unstructured objects.
+	// The unstructured mode doesn't require the types to be registered in the Scheme. Defaults to typed.
+	CacheObjectMode CacheObjectMode
+	// UnstructuredFallback makes kinds whose types aren't registered in the Scheme
+	// be read and watched as unstructured objects in the typed mode instead of failing.
+	UnstructuredFallback bool
+
+	// MetadataOnlyExact makes kinds only referenced by exact resources be cached as metadata only,
+	// the whole objects are read through the APIReader once their resourceVersion changes.
+	MetadataOnlyExact bool
+
+	// TrackStatusKinds are the kinds whose status is logged on every observation of their input resources,
+	// for input resources that are really about the status of the object. Their status must not be stripped from the cache.
+	TrackStatusKinds sets.Set[schema.GroupKind]
+
+	// OutputDir, when set, is the directory every observed input resource is written to as JSON.
+	// See observedResourcePath for the layout.
+	OutputDir string
+
+	// EventBufferSize is the number of events buffered between the informers and the controller,
+	// defaults to DefaultEventBufferSize. See NewEventDispatcher.
+	EventBufferSize int
+
+	// InformerStartupConcurrency is the number of informers registered at once while syncing,
+	// defaults to DefaultInformerStartupConcurrency.
+	InformerStartupConcurrency int
+
+	// PerObjectRate limits the events dispatched per input resource to this many per second, zero disables the limit.
+	// Events over the limit are coalesced, the latest one is dispatched once the resource is allowed again.
+	PerObjectRate float64
+	// PerObjectBurst is the number of events dispatched per input resource at once before PerObjectRate applies, defaults to 1.
+	PerObjectBurst int
+
+	// TolerantPartialSync lets the input resources sync without the informers that don't sync in time,
+	// they keep syncing in the background. See InputResourceInitializerOptions.TolerantPartialSync.
+	TolerantPartialSync bool
+	// EventHandlerStagger delays adding the event handler of every informer by a random duration of up to this long,
+	// zero disables it. See InputResourceInitializerOptions.EventHandlerStagger.
+	EventHandlerStagger time.Duration
+	// MaxCachedObjectsPerGVK fails the initial sync when the informer of a kind holds more objects, zero disables the limit.
+	MaxCachedObjectsPerGVK int
+
+	// FallbackToLiveClient makes an exact resource missing from the cache be read once through the APIReader,
+	// e.g. when it was just created and the informer hasn't observed it yet.
+	// The live reads are limited to liveFallbackQPS, a missing resource is reported as not found past the limit.
+	FallbackToLiveClient bool
+
+	// MaxConcurrentReconciles is the number of operators reconciled in parallel, defaults to 1.
+	// An operator is never reconciled by several workers at once, a reconcile of an operator already in flight
+	// waits for it to complete, adding up to the duration of a reconcile to its latency.
+	// The state shared between the operators is guarded.
+	MaxConcurrentReconciles int
+
+	// ReconcileBaseDelay and ReconcileMaxDelay configure the exponential backoff of the operators whose reconcile failed,
+	// the delay starts at ReconcileBaseDelay and doubles on every failure up to ReconcileMaxDelay.
+	// When both are zero the controller-runtime default rate limiter is used, otherwise the unset one
+	// takes the value of the controller-runtime default backoff.
+	ReconcileBaseDelay time.Duration
+	ReconcileMaxDelay  time.Duration
+
+	// OperatorWatch, when set, adds, changes and removes operators along the CRs representing them
+	// on the management cluster, next to the InputResources. See OperatorWatch.
+	OperatorWatch *OperatorWatch
+	// CacheRestrictedToInputResources tells that the Cache is restricted to the InputResources with InputResourceCacheOptions,
+	// operators added later by a reload or the OperatorWatch are rejected when the restriction hides their input resources.
+	CacheRestrictedToInputResources bool
+
+	// FullResyncInterval, when set, forces a reconcile of every operator on the interval,
+	// regardless of whether its input resources changed. See FullResyncer.
+	FullResyncInterval time.Duration
+
+	// ServeOperatorSnapshots serves what the caches hold of the input resources of an operator on /debug/operators
+	// of the metrics server, see SnapshotOperator. The values of Secrets are redacted, but the endpoint still exposes
+	// the input resources to every client of the metrics server, so it is disabled by default.
+	ServeOperatorSnapshots bool
+
+	// ReconcileDelay is waited at the start of every reconcile, the wait ends early once the context is done.
+	// It exists to make the order and batching of reconciles observable while debugging, zero disables it.
+	ReconcileDelay time.Duration
+
+	// Recorder, when set, emits an event on every input resource whose resourceVersion changed between two observations.
+	// Events about the same resource are emitted at most once per inputResourceEventWindow.
+	Recorder record.EventRecorder
+
+	// AuditLog, when it has a sink, gets an entry for every event dispatched to the controller.
+	AuditLog logr.Logger
+
+	// TracerProvider creates the spans around every reconcile and cache read, defaults to a no-op provider.
+	TracerProvider trace.TracerProvider
+
+	// lastObserved and recordedEvents are shared by the reconciles of all operators, they guard themselves
+	lastObserved   observedResources
+	recordedEvents eventDeduplicator
+	// inFlight makes a second reconcile of an operator wait for the first one,
+	// so that its observations and diffs are always recorded in order
+	inFlight inFlightOperators
+
+	// metadataOnlyKinds are keyed by the cluster name
+	metadataOnlyKinds map[string]sets.Set[schema.GroupVersionKind]
+
+	// initializers are keyed by the cluster name
+	initializers map[string]*InputResourceInitializer
+
+	backoffOnce sync.Once
+	backoff     *flowcontrol.Backoff
+
+	liveFallbackLimiterOnce sync.Once
+	liveFallbackLimiter     *rate.Limiter
+}
+
+func (r *DynamicReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if r.ReconcileDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctrl.Result{}, ctx.Err()
+		case <-time.After(r.ReconcileDelay):
+		}
+	}
+	// the logger controller-runtime injects carries the controller name and the reconcile ID
+	log := contextLogger(ctx, r.Log).WithValues("operator", req.Name)
+	if req.Namespace != "" {
+		log = log.WithValues("operatorNamespace", req.Namespace)
+	}
+	log.Info("observed operator")
+	if r.Mapper == nil {
+		return ctrl.Result{}, fmt.Errorf("restmapper is not configured")
+	}
+	if r.Cache == nil {
+		return ctrl.Result{}, fmt.Errorf("cache is not configured")
+	}
+	if r.Scheme == nil {
+		return ctrl.Result{}, fmt.Errorf("scheme is not configured")
+	}
+
+	operator := operatorIdentity{Namespace: req.Namespace, Name: req.Name}.String()
+	release, waited, err := r.inFlight.Acquire(ctx, operator)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	defer release()
+	if waited {
+		log.Info("waited for another reconcile of the operator to complete")
+	}
+
+	var clusters []InputResourceCluster
+	for _, c := range r.clusters() {
+		if err := r.forgetDeletedObjects(log.WithValues("cluster", c.Name), c.Name, operator); err != nil {
+			return ctrl.Result{}, err
+		}
+		if _, ok := c.InputResources[operator]; ok {
+			clusters = append(clusters, c)
+		}
+	}
+	if len(clusters) == 0 {
+		log.Info("no input resources declared for the operator, skipping")
+		return ctrl.Result{}, nil
+	}
+
+	ctx, span := r.tracer().Start(ctx, operator)
+	defer span.End()
+	start := time.Now()
+	defer func() {
+		reconcileDurationSeconds.WithLabelValues(operator).Observe(time.Since(start).Seconds())
+	}()
+
+	for _, c := range clusters {
+		if err = r.reconcileInputResources(ctx, log.WithValues("cluster", c.Name), c, operator, c.InputResources[operator]); err != nil {
+			break
+		}
+	}
+	var notSynced *informerNotSyncedError
+	if errors.As(err, &notSynced) {
+		log.Info("informer hasn't synced yet, requeueing", "gvk", notSynced.gvk.String(), "requeueAfter", informerNotSyncedRequeueAfter)
+		return ctrl.Result{RequeueAfter: informerNotSyncedRequeueAfter}, nil
+	}
+	if err != nil {
+		span.RecordError(err)
+		if !isTransientError(err) {
+			span.SetStatus(codes.Error, err.Error())
+			return ctrl.Result{}, err
+		}
+		backoff := r.transientErrorBackoff()
+		backoff.Next(operator, backoff.Clock.Now())
+		requeueAfter := backoff.Get(operator)
+		log.Info("transient error while reading the input resources, requeueing", "requeueAfter", requeueAfter, "err", err.Error())
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+	r.transientErrorBackoff().Reset(operator)
+	return ctrl.Result{}, nil
+}
+
+// Outcomes of reading an input resource, see inputResourceReadsTotal.
+const (
+	inputResourceReadFound    = "found"
+	inputResourceReadNotFound = "notfound"
+	inputResourceReadError    = "error"
+)
+
+// reconcileInputResources reads the input resources the operator declared on the cluster from the cluster's cache.
+func (r *DynamicReconciler) reconcileInputResources(ctx context.Context, log logr.Logger, c InputResourceCluster, operator string, resources *libraryinputresources.InputResources) error {
+	for _, list := range resourceListsOf(resources) {
+		if err := r.reconcileResourceList(ctx, log.WithValues("category", list.category), c, operator, list.ResourceList); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileResourceList reads the exact and label selected resources of a resource list from the cluster's cache.
+func (r *DynamicReconciler) reconcileResourceList(ctx context.Context, log logr.Logger, c InputResourceCluster, operator string, resources libraryinputresources.ResourceList) error {
+	for _, def := range resources.ExactResources {
+		id := def.InputResourceTypeIdentifier
+		if def.Name == "" {
+			log.Info("skipping resource without name", "group", id.Group, "version", id.Version, "resource", id.Resource)
+			continue
+		}
+
+		if err := r.checkInformerSynced(c, gvrFor(id)); err != nil {
+			return err
+		}
+		key := client.ObjectKey{Namespace: def.Namespace, Name: def.Name}
+		gvk, cachedObj, err := getFromCache(ctx, r.tracer(), c.Cache, c.Mapper, r.Scheme, gvrFor(id), key, r.objectOptionsFor(c.Name))
+		if err != nil {
+			if gvk.Empty() {
+				return err
+			}
+			if !apierrors.IsNotFound(err) {
+				inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadError).Inc()
+				return err
+			}
+			if cachedObj, err = r.liveFallbackFor(ctx, log, c, gvk, key); err != nil {
+				inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadError).Inc()
+				return err
+			}
+			if cachedObj == nil {
+				inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadNotFound).Inc()
+				log.Info("resource not found", "gvk", gvk.String(), "name", r.qualifiedName(c.Name, gvk, key))
+				continue
+			}
+		}
+		inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadFound).Inc()
+		if _, ok := cachedObj.(*metav1.PartialObjectMetadata); ok {
+			if cachedObj.GetResourceVersion() == r.lastObserved.LastResourceVersion(c.Name, operator, gvk, key) {
+				// unchanged since the last observation, no need for a live read
+				continue
+			}
+			cachedObj, err = r.fullObjectFor(ctx, c, gvk, key)
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					log.Info("resource not found", "gvk", gvk.String(), "name", r.qualifiedName(c.Name, gvk, key))
+					continue
+				}
+				return err
+			}
+		}
+		if err := r.observe(log, c.Name, operator, gvk, cachedObj); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range resources.LabelSelectedResources {
+		gvk, err := c.Mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+		if err != nil {
+			return err
+		}
+		if initializer, ok := r.initializers[c.Name]; ok && !initializer.InformerSynced(gvk) {
+			return &informerNotSyncedError{gvk: gvk}
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&def.LabelSelector)
+		if err != nil {
+			return err
+		}
+
+		cachedList, err := newObjectListFor(r.Scheme, gvk, r.objectOptionsFor(c.Name))
+		if err != nil {
+			return err
+		}
+		err = tracedCacheRead(ctx, r.tracer(), "Cache.List", gvk, func(ctx context.Context) error {
+			return c.Cache.List(ctx, cachedList, client.InNamespace(def.Namespace), client.MatchingLabelsSelector{Selector: selector})
+		})
+		if err != nil {
+			inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadError).Inc()
+			return err
+		}
+		items, err := meta.ExtractList(cachedList)
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadNotFound).Inc()
+		} else {
+			inputResourceReadsTotal.WithLabelValues(operator, inputResourceReadFound).Inc()
+		}
+		log.Info("listed resources from cache", "gvk", gvk.String(), "namespace", def.Namespace, "selector", selector.String(), "count", len(items))
+		for _, item := range items {
+			cachedObj, ok := item.(client.Object)
+			if !ok {
+				return fmt.Errorf("type %T does not implement client.Object", item)
+			}
+			if err := r.observe(log, c.Name, operator, gvk, cachedObj); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// informerNotSyncedRequeueAfter is how long a reconcile reading a kind whose informer hasn't synced waits before retrying.
+const informerNotSyncedRequeueAfter = 2 * time.Second
+
+// informerNotSyncedError reports that the informer of a kind hasn't synced yet,
+// reading from it could report objects that exist as not found.
+type informerNotSyncedError struct {
+	gvk schema.GroupVersionKind
+}
+
+func (e *informerNotSyncedError) Error() string {
+	return fmt.Sprintf("informer for %s hasn't synced", e.gvk)
+}
+
+// checkInformerSynced returns an informerNotSyncedError when the cluster's informer of the resource hasn't synced.
+// A resource that can't be resolved is left to the read to report.
+func (r *DynamicReconciler) checkInformerSynced(c InputResourceCluster, gvr schema.GroupVersionResource) error {
+	initializer, ok := r.initializers[c.Name]
+	if !ok {
+		return nil
+	}
+	gvk, err := c.Mapper.KindFor(gvr)
+	if err != nil {
+		return nil
+	}
+	if !initializer.InformerSynced(gvk) {
+		return &informerNotSyncedError{gvk: gvk}
+	}
+	return nil
+}
+
+// getFromCache reads the object of the resource from the cache, or any other reader.
+// The object is typed, unstructured or metadata only depending on the options.
+// The GVK is empty when the resource couldn't be resolved or no object could be created for it,
+// otherwise it is returned along with the error of the read, e.g. NotFound.
+func getFromCache(ctx context.Context, tracer trace.Tracer, reader client.Reader, mapper meta.RESTMapper, scheme *runtime.Scheme, gvr schema.GroupVersionResource, key client.ObjectKey, opts ObjectOptions) (schema.GroupVersionKind, client.Object, error) {
+	gvk, err := mapper.KindFor(gvr)
+	if err != nil {
+		return schema.GroupVersionKind{}, nil, err
+	}
+	obj, err := newObjectFor(scheme, gvk, opts)
+	if err != nil {
+		return schema.GroupVersionKind{}, nil, err
+	}
+	err = tracedCacheRead(ctx, tracer, "Cache.Get", gvk, func(ctx context.Context) error {
+		return reader.Get(ctx, key, obj)
+	})
+	return gvk, obj, err
+}
+
+// fullObjectFor reads the whole object from the API server, for kinds whose cache only holds the metadata.
+func (r *DynamicReconciler) fullObjectFor(ctx context.Context, c InputResourceCluster, gvk schema.GroupVersionKind, key client.ObjectKey) (client.Object, error) {
+	if c.APIReader == nil {
+		return nil, fmt.Errorf("api reader of the %s cluster is not configured", c.Name)
+	}
+	opts := r.objectOptionsFor(c.Name)
+	opts.MetadataOnlyKinds = nil
+	obj, err := newObjectFor(r.Scheme, gvk, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = tracedCacheRead(ctx, r.tracer(), "APIReader.Get", gvk, func(ctx context.Context) error {
+		return c.APIReader.Get(ctx, key, obj)
+	})
+	return obj, err
+}
+
+const (
+	liveFallbackQPS   = 1
+	liveFallbackBurst = 5
+)
+
+// liveFallbackFor reads an exact resource missing from the cache through the APIReader when FallbackToLiveClient is set.
+// It returns a nil object when the resource isn't on the API server either,
+// or when the fallback is disabled or over its rate.
+func (r *DynamicReconciler) liveFallbackFor(ctx context.Context, log logr.Logger, c InputResourceCluster, gvk schema.GroupVersionKind, key client.ObjectKey) (client.Object, error) {
+	if !r.FallbackToLiveClient {
+		return nil, nil
+	}
+	r.liveFallbackLimiterOnce.Do(func() {
+		r.liveFallbackLimiter = rate.NewLimiter(liveFallbackQPS, liveFallbackBurst)
+	})
+	if !r.liveFallbackLimiter.Allow() {
+		log.Info("resource not found in the cache, skipping the live read over its rate", "gvk", gvk.String(), "name", r.qualifiedName(c.Name, gvk, key))
+		return nil, nil
+	}
+	log.Info("resource not found in the cache, reading it from the API server", "gvk", gvk.String(), "name", r.qualifiedName(c.Name, gvk, key))
+	obj, err := r.fullObjectFor(ctx, c, gvk, key)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return obj, err
+}
+
+// observe logs an input resource read from the cache and records it in the output directory.
+func (r *DynamicReconciler) observe(log logr.Logger, clusterName, operator string, gvk schema.GroupVersionKind, cachedObj client.Object) error {
+	unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cachedObj)
+	if err != nil {
+		return err
+	}
+	obj := &unstructured.Unstructured{Object: unstructuredMap}
+	obj.SetGroupVersionKind(gvk)
+	key := client.ObjectKeyFromObject(obj)
+	name := r.qualifiedName(clusterName, gvk, key)
+
+	log.Info(
+		"resource from cache",
+		"gvk", gvk.String(),
+		"name", name,
+		"uid", obj.GetUID(),
+		"resourceVersion", obj.GetResourceVersion(),
+	)
+	if r.TrackStatusKinds.Has(gvk.GroupKind()) {
+		if status, found, _ := unstructured.NestedFieldNoCopy(obj.Object, "status"); found {
+			log.Info("resource status", "gvk", gvk.String(), "name", name, "status", status)
+		} else {
+			log.Info("resource has no status", "gvk", gvk.String(), "name", name)
+		}
+	}
+	diff, previousResourceVersion := r.lastObserved.Observe(clusterName, operator, obj)
+	if diff != "" {
+		log.Info("resource changed", "gvk", gvk.String(), "name", name, "diff", diff)
+	}
+	// the events are recorded on the management cluster, they can't refer to objects of other clusters
+	if r.Recorder != nil && clusterName == managementClusterName && previousResourceVersion != "" && previousResourceVersion != obj.GetResourceVersion() {
+		if r.recordedEvents.Allow(operator+"/"+gvk.String()+"/"+key.String(), time.Now()) {
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, "InputResourceChanged", "Input resource of operator %q changed, resourceVersion %s -> %s", operator, previousResourceVersion, obj.GetResourceVersion())
+		}
+	}
+
+	if r.OutputDir != "" {
+		outputDir := r.OutputDir
+		if clusterName != managementClusterName {
+			outputDir = filepath.Join(r.OutputDir, "clusters", clusterName)
+		}
+		written, err := writeObservedResource(outputDir, operator, obj)
+		if err != nil {
+			return err
+		}
+		if written {
+			log.Info("wrote resource to the output directory", "gvk", gvk.String(), "name", name, "path", observedResourcePath(outputDir, operator, obj))
+		}
+	}
+	return nil
+}
+
+// forgetDeletedObjects drops the input resources of the operator deleted from the cluster since its last reconcile
+// from the last observations and the output directory.
+func (r *DynamicReconciler) forgetDeletedObjects(log logr.Logger, clusterName, operator string) error {
+	initializer, ok := r.initializers[clusterName]
+	if !ok {
+		return nil
+	}
+	for _, deleted := range initializer.takeDeletedObjects(operator) {
+		unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deleted.obj)
+		if err != nil {
+			return err
+		}
+		obj := &unstructured.Unstructured{Object: unstructuredMap}
+		obj.SetGroupVersionKind(deleted.gvk)
+		key := client.ObjectKeyFromObject(obj)
+		name := r.qualifiedName(clusterName, deleted.gvk, key)
+
+		log.Info("resource deleted", "gvk", deleted.gvk.String(), "name", name, "uid", obj.GetUID(), "resourceVersion", obj.GetResourceVersion())
+		r.lastObserved.Forget(clusterName, operator, deleted.gvk, key)
+		if r.OutputDir != "" {
+			outputDir := r.OutputDir
+			if clusterName != managementClusterName {
+				outputDir = filepath.Join(r.OutputDir, "clusters", clusterName)
+			}
+			removed, err := removeObservedResource(outputDir, operator, obj)
+			if err != nil {
+				return err
+			}
+			if removed {
+				log.Info("removed resource from the output directory", "gvk", deleted.gvk.String(), "name", name, "path", observedResourcePath(outputDir, operator, obj))
+			}
+		}
+	}
+	return nil
+}
+
+func (r *DynamicReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Scheme == nil {
+		return fmt.Errorf("scheme is not configured")
+	}
+	c, err := controller.New("dynamic-unstructured", mgr, controller.Options{Reconciler: r, RateLimiter: r.rateLimiter(), MaxConcurrentReconciles: r.MaxConcurrentReconciles})
+	if err != nil {
+		return err
+	}
+
+	if err := r.setupClusterWithManager(mgr, c, managementClusterName, mgr, r.InputResources, r.InputResourceRefinements, false); err != nil {
+		return err
+	}
+	if r.ServeOperatorSnapshots {
+		if err := mgr.AddMetricsServerExtraHandler("/debug/operators", operatorSnapshotHandler(r)); err != nil {
+			return err
+		}
+	}
+	if r.FullResyncInterval > 0 {
+		if err := mgr.Add(NewFullResyncer(FullResyncerOptions{Log: r.Log.WithName("full-resync"), Interval: r.FullResyncInterval, Resync: r.resyncOperators})); err != nil {
+			return err
+		}
+	}
+	if r.GuestCluster == nil {
+		return nil
+	}
+	return r.setupClusterWithManager(mgr, c, guestClusterName, r.GuestCluster, r.GuestInputResources, r.GuestInputResourceRefinements, true)
+}
+
+// resyncOperators forces a reconcile of the operators of every cluster,
+// an operator observed on several clusters is only reconciled once since its requests are deduplicated by the queue.
+func (r *DynamicReconciler) resyncOperators() int {
+	resynced := 0
+	for _, initializer := range r.initializers {
+		resynced += initializer.ResyncOperators()
+	}
+	return resynced
+}
+
+const (
+	// defaultReconcileBaseDelay and defaultReconcileMaxDelay are the bounds of the controller-runtime default backoff.
+	defaultReconcileBaseDelay = 5 * time.Millisecond
+	defaultReconcileMaxDelay  = 1000 * time.Second
+)
+
+// rateLimiter returns the rate limiter of the controller's workqueue, nil for the controller-runtime default.
+func (r *DynamicReconciler) rateLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
+	if r.ReconcileBaseDelay == 0 && r.ReconcileMaxDelay == 0 {
+		return nil
+	}
+	baseDelay, maxDelay := r.ReconcileBaseDelay, r.ReconcileMaxDelay
+	if baseDelay == 0 {
+		baseDelay = defaultReconcileBaseDelay
+	}
+	if maxDelay == 0 {
+		maxDelay = defaultReconcileMaxDelay
+	}
+	return workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](baseDelay, maxDelay)
+}
+
+// setupClusterWithManager starts observing the input resources declared on the cluster,
+// their events are fed to the controller through a channel of their own.
+func (r *DynamicReconciler) setupClusterWithManager(mgr ctrl.Manager, c controller.Controller, clusterName string, inputCluster cluster.Cluster, inputResources map[string]*libraryinputresources.InputResources, refinements map[string]*InputResourceRefinements, isolated bool) error {
+	if r.MetadataOnlyExact {
+		kinds, err := exactOnlyKinds(inputCluster.GetRESTMapper(), inputResources)
+		if err != nil {
+			return err
+		}
+		if r.metadataOnlyKinds == nil {
+			r.metadataOnlyKinds = map[string]sets.Set[schema.GroupVersionKind]{}
+		}
+		r.metadataOnlyKinds[clusterName] = kinds
+	}
+	var audit AuditFunc
+	if r.AuditLog.GetSink() != nil {
+		audit = auditLogger(r.AuditLog.WithValues("cluster", clusterName))
+	}
+	// operators are only added later on the management cluster
+	var operatorWatch *OperatorWatch
+	var restrictedCache bool
+	if clusterName == managementClusterName {
+		operatorWatch = r.OperatorWatch
+		restrictedCache = r.CacheRestrictedToInputResources
+	}
+	initializer, err := NewBuilder(mgr).
+		WithController(c).
+		WithLogger(r.Log).
+		WithCluster(clusterName, inputCluster).
+		WithIsolation(isolated).
+		WithScheme(r.Scheme).
+		WithInputResources(inputResources).
+		WithInputResourceRefinements(refinements).
+		WithOperatorNameFunc(r.operatorNameFunc()).
+		WithBufferSize(r.EventBufferSize).
+		WithInformerStartupConcurrency(r.InformerStartupConcurrency).
+		WithPerObjectRateLimit(r.PerObjectRate, r.PerObjectBurst).
+		WithPartialSyncTolerance(r.TolerantPartialSync).
+		WithMaxCachedObjectsPerGVK(r.MaxCachedObjectsPerGVK).
+		WithEventHandlerStagger(r.EventHandlerStagger).
+		WithOperatorWatch(operatorWatch).
+		WithRestrictedCache(restrictedCache).
+		WithOperatorRemovedFunc(func(operator string) { r.lastObserved.ForgetOperator(clusterName, operator) }).
+		WithObjectOptions(r.objectOptionsFor(clusterName)).
+		WithAudit(audit).
+		WithDeletedObjectTracking(true).
+		Build(r)
+	if err != nil {
+		return err
+	}
+	if r.initializers == nil {
+		r.initializers = map[string]*InputResourceInitializer{}
+	}
+	r.initializers[clusterName] = initializer
+	return nil
+}
+
+// clusters returns the clusters the input resources are read from, the management cluster comes first.
+// Once set up, the input resources are the ones currently observed by the cluster's initializer.
+func (r *DynamicReconciler) clusters() []InputResourceCluster {
+	clusters := []InputResourceCluster{{
+		Name:           managementClusterName,
+		Cache:          r.Cache,
+		Mapper:         r.Mapper,
+		APIReader:      r.APIReader,
+		InputResources: r.InputResources,
+	}}
+	if r.GuestCluster != nil {
+		clusters = append(clusters, r.guestCluster())
+	}
+	for idx := range clusters {
+		if initializer, ok := r.initializers[clusters[idx].Name]; ok {
+			clusters[idx].InputResources = initializer.InputResources()
+		}
+	}
+	return clusters
+}
+
+// Reload updates the input resources observed on the management cluster, see InputResourceInitializer.Reload.
+func (r *DynamicReconciler) Reload(ctx context.Context, inputResources map[string]*libraryinputresources.InputResources) error {
+	initializer, ok := r.initializers[managementClusterName]
+	if !ok {
+		return fmt.Errorf("the reconciler hasn't been set up with a manager")
+	}
+	return initializer.Reload(ctx, inputResources)
+}
+
+// qualifiedName formats the key of an object of the cluster for the logs, see qualifiedName.
+func (r *DynamicReconciler) qualifiedName(clusterName string, gvk schema.GroupVersionKind, key client.ObjectKey) string {
+	mapper := r.Mapper
+	if clusterName == guestClusterName && r.GuestCluster != nil {
+		mapper = r.GuestCluster.GetRESTMapper()
+	}
+	return qualifiedName(mapper, gvk, key)
+}
+
+func (r *DynamicReconciler) guestCluster() InputResourceCluster {
+	return InputResourceCluster{
+		Name:           guestClusterName,
+		Cache:          r.GuestCluster.GetCache(),
+		Mapper:         r.GuestCluster.GetRESTMapper(),
+		APIReader:      r.GuestCluster.GetAPIReader(),
+		InputResources: r.GuestInputResources,
+		Isolated:       true,
+	}
+}
+
+// transientErrorBackoff returns the per operator backoff used to requeue after transient errors.
+func (r *DynamicReconciler) transientErrorBackoff() *flowcontrol.Backoff {
+	r.backoffOnce.Do(func() {
+		r.backoff = flowcontrol.NewBackOff(transientErrorInitialBackoff, transientErrorMaxBackoff)
+	})
+	return r.backoff
+}
+
+const (
+	transientErrorInitialBackoff = time.Second
+	transientErrorMaxBackoff     = 5 * time.Minute
+)
+
+// isTransientError reports whether the error is expected to go away on its own, like a throttled or timed out request.
+func isTransientError(err error) bool {
+	return apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsServiceUnavailable(err)
+}
+
+func (r *DynamicReconciler) tracer() trace.Tracer {
+	if r.TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+	return r.TracerProvider.Tracer(tracerName)
+}
+
+func (r *DynamicReconciler) operatorNameFunc() OperatorNameFunc {
+	if r.OperatorNameFunc == nil {
+		return OperatorNameFromLabel(DefaultOperatorNameLabel)
+	}
+	return r.OperatorNameFunc
+}
+
+func (r *DynamicReconciler) objectOptionsFor(clusterName string) ObjectOptions {
+	return ObjectOptions{Mode: r.CacheObjectMode, UnstructuredFallback: r.UnstructuredFallback, MetadataOnlyKinds: r.metadataOnlyKinds[clusterName]}
+}
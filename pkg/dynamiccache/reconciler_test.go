@@ -0,0 +1,197 @@
+package dynamiccache_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache/dynamiccachetest"
+)
+
+func TestReconcile(t *testing.T) {
+	configKey := client.ObjectKey{Namespace: "ns", Name: "config"}
+	tests := []struct {
+		name string
+		// prepare fills the cache the reconciler reads from
+		prepare     func(t *testing.T, c *dynamiccachetest.Cache)
+		operator    string
+		wantErr     error
+		wantRequeue bool
+		// wantObserved is set when the configmap is expected to be observed and written to the output dir
+		wantObserved bool
+	}{
+		{
+			name:     "found",
+			operator: "a",
+			prepare: func(t *testing.T, c *dynamiccachetest.Cache) {
+				if err := c.Add(configMap("ns", "config")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantObserved: true,
+		},
+		{
+			name:     "not found",
+			operator: "a",
+		},
+		{
+			name:     "injected error",
+			operator: "a",
+			prepare: func(t *testing.T, c *dynamiccachetest.Cache) {
+				c.InjectGetError(configMapGVK, configKey, errBoom)
+			},
+			wantErr: errBoom,
+		},
+		{
+			name:     "injected transient error",
+			operator: "a",
+			prepare: func(t *testing.T, c *dynamiccachetest.Cache) {
+				c.InjectGetError(configMapGVK, configKey, apierrors.NewServiceUnavailable("unavailable"))
+			},
+			wantRequeue: true,
+		},
+		{
+			name:     "injected list error",
+			operator: "a",
+			prepare: func(t *testing.T, c *dynamiccachetest.Cache) {
+				if err := c.Add(configMap("ns", "config")); err != nil {
+					t.Fatal(err)
+				}
+				c.InjectListError(secretGVK, errBoom)
+			},
+			wantErr:      errBoom,
+			wantObserved: true,
+		},
+		{
+			name:     "operator without input resources",
+			operator: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := dynamiccachetest.NewCache(clientgoscheme.Scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, c)
+			}
+			outputDir := t.TempDir()
+			r := &dynamiccache.DynamicReconciler{
+				Log:    logr.Discard(),
+				Mapper: testMapper(),
+				Scheme: clientgoscheme.Scheme,
+				Cache:  c,
+				InputResources: map[string]*libraryinputresources.InputResources{
+					"a": applyConfigurationResources(
+						[]libraryinputresources.ExactResourceID{exactConfigMap("ns", "config")},
+						labelSelectedSecrets("ns", map[string]string{"app": "a"}),
+					),
+				},
+				OutputDir: outputDir,
+			}
+
+			result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Name: tt.operator}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected the error %v, got %v", tt.wantErr, err)
+			}
+			if requeued := result.RequeueAfter > 0; requeued != tt.wantRequeue {
+				t.Errorf("expected requeue %v, got %v", tt.wantRequeue, result)
+			}
+			_, err = os.Stat(filepath.Join(outputDir, "a", "core", configMapGVK.Kind, "ns_config.json"))
+			if observed := err == nil; observed != tt.wantObserved {
+				t.Errorf("expected the configmap to be observed %v, got %v", tt.wantObserved, observed)
+			}
+		})
+	}
+}
+
+var errBoom = errors.New("boom")
+
+func TestReconcileDelayCancelled(t *testing.T) {
+	c, err := dynamiccachetest.NewCache(clientgoscheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &dynamiccache.DynamicReconciler{
+		Log:            logr.Discard(),
+		Mapper:         testMapper(),
+		Scheme:         clientgoscheme.Scheme,
+		Cache:          c,
+		ReconcileDelay: time.Minute,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKey{Name: "a"}})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the context's error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the reconcile to return once the context is done, it is still waiting for the delay")
+	}
+}
+
+func TestReconcileTransientErrorBackoff(t *testing.T) {
+	c, err := dynamiccachetest.NewCache(clientgoscheme.Scheme, configMap("ns", "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &dynamiccache.DynamicReconciler{
+		Log:    logr.Discard(),
+		Mapper: testMapper(),
+		Scheme: clientgoscheme.Scheme,
+		Cache:  c,
+		InputResources: map[string]*libraryinputresources.InputResources{
+			"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactConfigMap("ns", "config")}),
+		},
+	}
+	configKey := client.ObjectKey{Namespace: "ns", Name: "config"}
+	reconcile := func() ctrl.Result {
+		t.Helper()
+		result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "a"}})
+		if err != nil {
+			t.Fatalf("expected transient errors to be requeued rather than returned, got %v", err)
+		}
+		return result
+	}
+
+	// the cache times out a few times, then succeeds
+	c.InjectGetError(configMapGVK, configKey, apierrors.NewTimeoutError("timeout", 1))
+	var previous time.Duration
+	for attempt := range 3 {
+		result := reconcile()
+		if result.RequeueAfter <= previous {
+			t.Fatalf("expected the requeue delay to grow on attempt %d, got %v after %v", attempt, result.RequeueAfter, previous)
+		}
+		previous = result.RequeueAfter
+	}
+	c.InjectGetError(configMapGVK, configKey, nil)
+	if result := reconcile(); result.RequeueAfter != 0 {
+		t.Fatalf("expected no requeue once the read succeeds, got %v", result.RequeueAfter)
+	}
+
+	// the backoff starts over after the success
+	c.InjectGetError(configMapGVK, configKey, apierrors.NewTimeoutError("timeout", 1))
+	first := reconcile()
+	if first.RequeueAfter <= 0 || first.RequeueAfter >= previous {
+		t.Errorf("expected the requeue delay to be reset below %v, got %v", previous, first.RequeueAfter)
+	}
+}
@@ -0,0 +1,146 @@
+package dynamiccache
+
+import (
+	"fmt"
+	"regexp"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InputResourceRefinements narrow down what the input resources of an operator match,
+// with criteria libraryinputresources can't declare. Every refinement applies to the resources the operator declared
+// equal to the one it embeds, in all resource lists, and is ANDed with what they match already.
+// Only the dispatched events are refined, the reconciler still reads the declared resources.
+type InputResourceRefinements struct {
+	ExactResources         []ExactResource         `json:"exactResources,omitempty"`
+	LabelSelectedResources []LabelSelectedResource `json:"labelSelectedResources,omitempty"`
+}
+
+// ExactResource refines an exact resource declared by an operator.
+type ExactResource struct {
+	libraryinputresources.ExactResourceID `json:",inline"`
+
+	// UID, when set, only matches the object with the UID, an object recreated under the same name doesn't match anymore.
+	UID types.UID `json:"uid,omitempty"`
+	// NameRegex, when set, only matches the objects whose whole name matches the regular expression,
+	// e.g. "revision-status-.*" along an exact resource without a name.
+	NameRegex string `json:"nameRegex,omitempty"`
+}
+
+// compileNameRegex compiles the name pattern of the refinement so that it matches whole names, nil when it has none.
+func compileNameRegex(refinement *ExactResource) (*regexp.Regexp, error) {
+	if refinement.NameRegex == "" {
+		return nil, nil
+	}
+	// the pattern is checked on its own, so that the errors don't refer to the anchors
+	if _, err := regexp.Compile(refinement.NameRegex); err != nil {
+		return nil, fmt.Errorf("invalid name regex %q: %w", refinement.NameRegex, err)
+	}
+	return regexp.Compile("^(?:" + refinement.NameRegex + ")$")
+}
+
+// LabelSelectedResource refines a label selected resource declared by an operator.
+type LabelSelectedResource struct {
+	libraryinputresources.LabelSelectedResource `json:",inline"`
+
+	// Annotation, when set, only matches the selected objects carrying the annotation.
+	Annotation *AnnotationMatch `json:"annotation,omitempty"`
+}
+
+// AnnotationMatch matches the objects carrying an annotation.
+type AnnotationMatch struct {
+	Key string `json:"key"`
+	// Value, when set, has to be the value of the annotation, otherwise the annotation only has to be present.
+	Value *string `json:"value,omitempty"`
+}
+
+// String returns the annotation as a selector, e.g. "key" or "key=value".
+func (a AnnotationMatch) String() string {
+	if a.Value == nil {
+		return a.Key
+	}
+	return a.Key + "=" + *a.Value
+}
+
+// annotationMatcher returns a function matching the objects carrying the annotation, the key must be a qualified name.
+func annotationMatcher(match AnnotationMatch) (func(obj client.Object) bool, error) {
+	if errs := validation.IsQualifiedName(match.Key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid annotation key %q: %v", match.Key, errs)
+	}
+	return func(obj client.Object) bool {
+		value, ok := obj.GetAnnotations()[match.Key]
+		if !ok {
+			return false
+		}
+		return match.Value == nil || value == *match.Value
+	}, nil
+}
+
+// exactRefinementFor returns the refinement of the exact resource, if any.
+func exactRefinementFor(refinements *InputResourceRefinements, def libraryinputresources.ExactResourceID) *ExactResource {
+	if refinements == nil {
+		return nil
+	}
+	for idx := range refinements.ExactResources {
+		if refinements.ExactResources[idx].ExactResourceID == def {
+			return &refinements.ExactResources[idx]
+		}
+	}
+	return nil
+}
+
+// labelSelectedRefinementFor returns the refinement of the label selected resource, if any.
+func labelSelectedRefinementFor(refinements *InputResourceRefinements, def libraryinputresources.LabelSelectedResource) *LabelSelectedResource {
+	if refinements == nil {
+		return nil
+	}
+	for idx := range refinements.LabelSelectedResources {
+		if equality.Semantic.DeepEqual(refinements.LabelSelectedResources[idx].LabelSelectedResource, def) {
+			return &refinements.LabelSelectedResources[idx]
+		}
+	}
+	return nil
+}
+
+// validateInputResourceRefinements checks that every refinement applies to a resource the operator declared,
+// a refinement applying to nothing is most likely a typo in the declaration it should refine.
+func validateInputResourceRefinements(operator string, resources *libraryinputresources.InputResources, refinements *InputResourceRefinements) []error {
+	if refinements == nil {
+		return nil
+	}
+	var errs []error
+	for idx, refinement := range refinements.ExactResources {
+		declared := false
+		for _, list := range resourceListsOf(resources) {
+			for _, def := range list.ExactResources {
+				if refinement.ExactResourceID == def {
+					declared = true
+				}
+			}
+		}
+		if !declared {
+			errs = append(errs, fmt.Errorf("operator %q: exact resource refinement #%d (namespace=%q, name=%q) doesn't refine any declared exact resource", operator, idx, refinement.Namespace, refinement.Name))
+		}
+		if _, err := compileNameRegex(&refinement); err != nil {
+			errs = append(errs, fmt.Errorf("operator %q: exact resource refinement #%d (namespace=%q, name=%q): %w", operator, idx, refinement.Namespace, refinement.Name, err))
+		}
+	}
+	for idx, refinement := range refinements.LabelSelectedResources {
+		declared := false
+		for _, list := range resourceListsOf(resources) {
+			for _, def := range list.LabelSelectedResources {
+				if equality.Semantic.DeepEqual(refinement.LabelSelectedResource, def) {
+					declared = true
+				}
+			}
+		}
+		if !declared {
+			errs = append(errs, fmt.Errorf("operator %q: label selected resource refinement #%d (namespace=%q) doesn't refine any declared label selected resource", operator, idx, refinement.Namespace))
+		}
+	}
+	return errs
+}
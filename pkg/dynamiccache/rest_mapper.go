@@ -0,0 +1,235 @@
+package dynamiccache
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/restmapper"
+)
+
+// DefaultMapperRetryMaxInterval is the longest a kind or resource that doesn't match waits
+// before the discovery information is refreshed for it again.
+const DefaultMapperRetryMaxInterval = 2 * time.Minute
+
+// RefreshingRESTMapperOptions configures the RESTMapper created by NewRefreshingRESTMapper.
+type RefreshingRESTMapperOptions struct {
+	Log logr.Logger
+	// MaxRetryInterval caps the backoff between two refreshes for a kind or resource that doesn't match,
+	// defaults to DefaultMapperRetryMaxInterval.
+	MaxRetryInterval time.Duration
+}
+
+// missedLookup is the backoff of a kind or resource that didn't match after a refresh.
+type missedLookup struct {
+	backoff   wait.Backoff
+	nextRetry time.Time
+}
+
+// refreshingRESTMapper is a discovery based RESTMapper that resets its discovery information
+// and retries once when a kind or resource doesn't match, so that CRDs installed after startup
+// resolve without restarting the process.
+//
+// A kind or resource that still doesn't match after a refresh is retried with a jittered exponential backoff,
+// so that lookups of a missing CRD don't hammer discovery. Concurrent misses share a single refresh.
+type refreshingRESTMapper struct {
+	log              logr.Logger
+	discoveryClient  discovery.DiscoveryInterface
+	maxRetryInterval time.Duration
+
+	lock     sync.RWMutex
+	delegate meta.RESTMapper
+	// generation is bumped every time the discovery information is fetched
+	generation uint64
+
+	missesLock sync.Mutex
+	misses     map[string]*missedLookup
+}
+
+var _ meta.ResettableRESTMapper = (*refreshingRESTMapper)(nil)
+
+// NewRefreshingRESTMapper returns a RESTMapper resolving kinds and resources through the discovery client,
+// see refreshingRESTMapper.
+func NewRefreshingRESTMapper(discoveryClient discovery.DiscoveryInterface, opts RefreshingRESTMapperOptions) meta.ResettableRESTMapper {
+	maxRetryInterval := opts.MaxRetryInterval
+	if maxRetryInterval <= 0 {
+		maxRetryInterval = DefaultMapperRetryMaxInterval
+	}
+	return &refreshingRESTMapper{
+		log:              opts.Log,
+		discoveryClient:  discoveryClient,
+		maxRetryInterval: maxRetryInterval,
+		misses:           map[string]*missedLookup{},
+	}
+}
+
+// Reset drops the discovery information, it is fetched again on the next lookup.
+func (m *refreshingRESTMapper) Reset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.delegate = nil
+}
+
+func (m *refreshingRESTMapper) getDelegate() (meta.RESTMapper, uint64, error) {
+	m.lock.RLock()
+	delegate, generation := m.delegate, m.generation
+	m.lock.RUnlock()
+	if delegate != nil {
+		return delegate, generation, nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.delegate != nil {
+		return m.delegate, m.generation, nil
+	}
+	groupResources, err := restmapper.GetAPIGroupResources(m.discoveryClient)
+	if err != nil {
+		return nil, 0, err
+	}
+	m.delegate = restmapper.NewDiscoveryRESTMapper(groupResources)
+	m.generation++
+	return m.delegate, m.generation, nil
+}
+
+// resetIfCurrent drops the discovery information unless it was already refreshed since the given generation,
+// so that concurrent misses share a single refresh.
+func (m *refreshingRESTMapper) resetIfCurrent(generation uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.generation == generation {
+		m.delegate = nil
+	}
+}
+
+// shouldRefresh reports whether the lookup may refresh the discovery information,
+// it doesn't while the backoff of a previous miss hasn't elapsed.
+func (m *refreshingRESTMapper) shouldRefresh(lookup string) bool {
+	m.missesLock.Lock()
+	defer m.missesLock.Unlock()
+
+	miss, ok := m.misses[lookup]
+	return !ok || !time.Now().Before(miss.nextRetry)
+}
+
+// recordMiss schedules the next refresh for a lookup that didn't match after a refresh.
+func (m *refreshingRESTMapper) recordMiss(lookup string) {
+	m.missesLock.Lock()
+	defer m.missesLock.Unlock()
+
+	miss, ok := m.misses[lookup]
+	if !ok {
+		miss = &missedLookup{backoff: wait.Backoff{
+			Duration: time.Second,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    math.MaxInt32,
+			Cap:      m.maxRetryInterval,
+		}}
+		m.misses[lookup] = miss
+	}
+	miss.nextRetry = time.Now().Add(miss.backoff.Step())
+}
+
+// recordMatch forgets the backoff of a lookup that matches, logging that it finally resolved.
+func (m *refreshingRESTMapper) recordMatch(lookup string) {
+	m.missesLock.Lock()
+	defer m.missesLock.Unlock()
+
+	if _, ok := m.misses[lookup]; ok {
+		delete(m.misses, lookup)
+		m.log.Info("kind or resource resolved after not matching before", "lookup", lookup)
+	}
+}
+
+// withRefresh calls fn with the current discovery information,
+// and once more with fresh discovery information when fn reports no match,
+// unless the lookup is backing off from a previous miss.
+func withRefresh[T any](m *refreshingRESTMapper, lookup string, fn func(meta.RESTMapper) (T, error)) (T, error) {
+	delegate, generation, err := m.getDelegate()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	ret, err := fn(delegate)
+	if !meta.IsNoMatchError(err) {
+		if err == nil {
+			m.recordMatch(lookup)
+		}
+		return ret, err
+	}
+	if !m.shouldRefresh(lookup) {
+		return ret, err
+	}
+
+	m.resetIfCurrent(generation)
+	if delegate, _, err = m.getDelegate(); err != nil {
+		var zero T
+		return zero, err
+	}
+	ret, err = fn(delegate)
+	switch {
+	case meta.IsNoMatchError(err):
+		m.recordMiss(lookup)
+	case err == nil:
+		m.recordMatch(lookup)
+	}
+	return ret, err
+}
+
+// mappingLookup identifies a RESTMapping lookup for the backoff of its misses.
+func mappingLookup(gk schema.GroupKind, versions []string) string {
+	return fmt.Sprintf("%s%v", gk, versions)
+}
+
+func (m *refreshingRESTMapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	return withRefresh(m, resource.String(), func(delegate meta.RESTMapper) (schema.GroupVersionKind, error) {
+		return delegate.KindFor(resource)
+	})
+}
+
+func (m *refreshingRESTMapper) KindsFor(resource schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	return withRefresh(m, resource.String(), func(delegate meta.RESTMapper) ([]schema.GroupVersionKind, error) {
+		return delegate.KindsFor(resource)
+	})
+}
+
+func (m *refreshingRESTMapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	return withRefresh(m, input.String(), func(delegate meta.RESTMapper) (schema.GroupVersionResource, error) {
+		return delegate.ResourceFor(input)
+	})
+}
+
+func (m *refreshingRESTMapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
+	return withRefresh(m, input.String(), func(delegate meta.RESTMapper) ([]schema.GroupVersionResource, error) {
+		return delegate.ResourcesFor(input)
+	})
+}
+
+func (m *refreshingRESTMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	return withRefresh(m, mappingLookup(gk, versions), func(delegate meta.RESTMapper) (*meta.RESTMapping, error) {
+		return delegate.RESTMapping(gk, versions...)
+	})
+}
+
+func (m *refreshingRESTMapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
+	return withRefresh(m, mappingLookup(gk, versions), func(delegate meta.RESTMapper) ([]*meta.RESTMapping, error) {
+		return delegate.RESTMappings(gk, versions...)
+	})
+}
+
+func (m *refreshingRESTMapper) ResourceSingularizer(resource string) (string, error) {
+	delegate, _, err := m.getDelegate()
+	if err != nil {
+		return "", err
+	}
+	return delegate.ResourceSingularizer(resource)
+}
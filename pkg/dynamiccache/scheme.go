@@ -0,0 +1,75 @@
+package dynamiccache
+
+import (
+	"fmt"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// NewScheme returns a scheme with all client-go and apiextensions types registered,
+// plus the types registered by addToSchemes.
+// Kinds still missing from it are handled as unstructured objects when the fallback is enabled.
+func NewScheme(addToSchemes ...func(*runtime.Scheme) error) (*runtime.Scheme, error) {
+	return newSchemeWith(append([]func(*runtime.Scheme) error{clientgoscheme.AddToScheme, apiextensionsv1.AddToScheme}, addToSchemes...))
+}
+
+// autoscalingSchemeBuilder registers both stable versions of autoscaling, v2 didn't replace all of v1.
+var autoscalingSchemeBuilder = runtime.NewSchemeBuilder(autoscalingv1.AddToScheme, autoscalingv2.AddToScheme)
+
+// WellKnownSchemes register the stable versions of the well-known API groups, keyed by a short name of the group.
+var WellKnownSchemes = map[string]func(*runtime.Scheme) error{
+	"core":                  corev1.AddToScheme,
+	"admissionregistration": admissionregistrationv1.AddToScheme,
+	"apiextensions":         apiextensionsv1.AddToScheme,
+	"apps":                  appsv1.AddToScheme,
+	"autoscaling":           autoscalingSchemeBuilder.AddToScheme,
+	"batch":                 batchv1.AddToScheme,
+	"certificates":          certificatesv1.AddToScheme,
+	"coordination":          coordinationv1.AddToScheme,
+	"discovery":             discoveryv1.AddToScheme,
+	"networking":            networkingv1.AddToScheme,
+	"policy":                policyv1.AddToScheme,
+	"rbac":                  rbacv1.AddToScheme,
+	"scheduling":            schedulingv1.AddToScheme,
+	"storage":               storagev1.AddToScheme,
+}
+
+// NewSchemeFor returns a scheme with the core types and the well-known groups registered, see WellKnownSchemes,
+// plus the types registered by addToSchemes. All unknown group names are reported at once.
+func NewSchemeFor(groups []string, addToSchemes ...func(*runtime.Scheme) error) (*runtime.Scheme, error) {
+	if unknown := sets.New(groups...).Difference(sets.KeySet(WellKnownSchemes)); unknown.Len() > 0 {
+		return nil, fmt.Errorf("unknown scheme groups %v, available groups: %v", sets.List(unknown), sets.List(sets.KeySet(WellKnownSchemes)))
+	}
+	selected := []func(*runtime.Scheme) error{corev1.AddToScheme}
+	for _, group := range sets.List(sets.New(groups...)) {
+		selected = append(selected, WellKnownSchemes[group])
+	}
+	return newSchemeWith(append(selected, addToSchemes...))
+}
+
+func newSchemeWith(addToSchemes []func(*runtime.Scheme) error) (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range addToSchemes {
+		if err := addToScheme(scheme); err != nil {
+			return nil, err
+		}
+	}
+	return scheme, nil
+}
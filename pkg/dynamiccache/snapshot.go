@@ -0,0 +1,152 @@
+package dynamiccache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterSnapshot holds what the cache of a cluster currently holds of the input resources an operator declared on it.
+type ClusterSnapshot struct {
+	Cluster string                      `json:"cluster"`
+	Objects []unstructured.Unstructured `json:"objects"`
+	// NotFound lists the exact resources missing from the cache, as <gvk> <namespace/name>.
+	NotFound []string `json:"notFound,omitempty"`
+}
+
+// SnapshotOperator reads the input resources the operator declared on every cluster from the caches,
+// the exact resources missing from a cache are omitted and logged. The values of Secrets are redacted, their keys are kept.
+// The objects are read like Reconcile reads them, typed, unstructured or metadata only depending on the options,
+// and returned as unstructured objects.
+func (r *DynamicReconciler) SnapshotOperator(ctx context.Context, operator string) ([]unstructured.Unstructured, error) {
+	snapshots, err := r.snapshotOperator(ctx, operator)
+	if err != nil {
+		return nil, err
+	}
+	var objects []unstructured.Unstructured
+	for _, snapshot := range snapshots {
+		for _, notFound := range snapshot.NotFound {
+			r.Log.Info("input resource not found in the cache, omitted from the snapshot", "operator", operator, "cluster", snapshot.Cluster, "resource", notFound)
+		}
+		objects = append(objects, snapshot.Objects...)
+	}
+	return objects, nil
+}
+
+// snapshotOperator reads the input resources the operator declared on every cluster from the caches, per cluster.
+func (r *DynamicReconciler) snapshotOperator(ctx context.Context, operator string) ([]ClusterSnapshot, error) {
+	var snapshots []ClusterSnapshot
+	for _, c := range r.clusters() {
+		resources, ok := c.InputResources[operator]
+		if !ok {
+			continue
+		}
+		snapshot := ClusterSnapshot{Cluster: c.Name, Objects: []unstructured.Unstructured{}}
+		for _, list := range resourceListsOf(resources) {
+			if err := r.snapshotResourceList(ctx, c, list.ResourceList, &snapshot); err != nil {
+				return nil, fmt.Errorf("cluster %q: %w", c.Name, err)
+			}
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if snapshots == nil {
+		return nil, fmt.Errorf("operator %q didn't declare any input resources", operator)
+	}
+	return snapshots, nil
+}
+
+func (r *DynamicReconciler) snapshotResourceList(ctx context.Context, c InputResourceCluster, resources libraryinputresources.ResourceList, snapshot *ClusterSnapshot) error {
+	for _, def := range resources.ExactResources {
+		if def.Name == "" {
+			continue
+		}
+		key := client.ObjectKey{Namespace: def.Namespace, Name: def.Name}
+		gvk, cachedObj, err := getFromCache(ctx, r.tracer(), c.Cache, c.Mapper, r.Scheme, gvrFor(def.InputResourceTypeIdentifier), key, r.objectOptionsFor(c.Name))
+		if err != nil {
+			if !gvk.Empty() && apierrors.IsNotFound(err) {
+				snapshot.NotFound = append(snapshot.NotFound, gvk.String()+" "+r.qualifiedName(c.Name, gvk, key))
+				continue
+			}
+			return err
+		}
+		if err := appendSnapshotObject(snapshot, gvk, cachedObj); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range resources.LabelSelectedResources {
+		gvk, err := c.Mapper.KindFor(gvrFor(def.InputResourceTypeIdentifier))
+		if err != nil {
+			return err
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&def.LabelSelector)
+		if err != nil {
+			return err
+		}
+		cachedList, err := newObjectListFor(r.Scheme, gvk, r.objectOptionsFor(c.Name))
+		if err != nil {
+			return err
+		}
+		if err := c.Cache.List(ctx, cachedList, client.InNamespace(def.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return err
+		}
+		items, err := meta.ExtractList(cachedList)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := appendSnapshotObject(snapshot, gvk, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendSnapshotObject(snapshot *ClusterSnapshot, gvk schema.GroupVersionKind, obj runtime.Object) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	redactSecretData(gvk, content)
+	u := unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	snapshot.Objects = append(snapshot.Objects, u)
+	return nil
+}
+
+// operatorSnapshotHandler serves the input resources the cache holds for the operator of the operator query parameter,
+// as JSON per cluster. Namespaced operators are written as <namespace>/<name>.
+// The metrics server doesn't authenticate its clients, so it is only served when enabled, see DynamicReconciler.ServeOperatorSnapshots.
+func operatorSnapshotHandler(r *DynamicReconciler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		operator := req.URL.Query().Get("operator")
+		if operator == "" {
+			http.Error(w, "the operator query parameter is required", http.StatusBadRequest)
+			return
+		}
+		snapshots, err := r.snapshotOperator(req.Context(), operator)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(snapshots); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(buf.Bytes())
+	})
+}
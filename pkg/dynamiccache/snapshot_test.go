@@ -0,0 +1,63 @@
+package dynamiccache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache"
+	"github.com/p0lyn0mial/controller-runtime-dynamic-cache/pkg/dynamiccache/dynamiccachetest"
+)
+
+func TestSnapshotOperatorRedactsSecrets(t *testing.T) {
+	token := secret("ns", "bootstrap-token", map[string]string{"app": "a"})
+	token.Data = map[string][]byte{"token-secret": []byte("s3cr3t")}
+	token.StringData = map[string]string{"password": "hunter2"}
+	config := configMap("ns", "config")
+	config.Data = map[string]string{"key": "value"}
+	c, err := dynamiccachetest.NewCache(clientgoscheme.Scheme, token, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &dynamiccache.DynamicReconciler{
+		Log:    logr.Discard(),
+		Mapper: testMapper(),
+		Scheme: clientgoscheme.Scheme,
+		Cache:  c,
+		InputResources: map[string]*libraryinputresources.InputResources{
+			"a": applyConfigurationResources(
+				[]libraryinputresources.ExactResourceID{exactConfigMap("ns", "config")},
+				labelSelectedSecrets("ns", map[string]string{"app": "a"}),
+			),
+		},
+	}
+
+	objects, err := r.SnapshotOperator(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("expected the configmap and the secret, got %d objects", len(objects))
+	}
+	for _, obj := range objects {
+		switch obj.GetKind() {
+		case "Secret":
+			for field, key := range map[string]string{"data": "token-secret", "stringData": "password"} {
+				value, _, _ := unstructured.NestedString(obj.Object, field, key)
+				if value != "<redacted>" {
+					t.Errorf("expected the %s %s of the secret to be redacted, got %q", field, key, value)
+				}
+			}
+		case "ConfigMap":
+			if value, _, _ := unstructured.NestedString(obj.Object, "data", "key"); value != "value" {
+				t.Errorf("expected the data of the configmap to be left alone, got %q", value)
+			}
+		default:
+			t.Errorf("unexpected object of kind %s", obj.GetKind())
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package dynamiccache
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const tracerName = "controller-runtime-dynamic-cache"
+
+// NewOTLPTracerProvider returns a tracer provider exporting the spans over OTLP gRPC to the endpoint.
+// The exporter also honours the standard OTEL_EXPORTER_OTLP_* environment variables, e.g. for TLS.
+func NewOTLPTracerProvider(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(tracerName))),
+	), nil
+}
+
+// tracedCacheRead runs the read in a child span recording the GVK and whether the object was found.
+func tracedCacheRead(ctx context.Context, tracer trace.Tracer, spanName string, gvk schema.GroupVersionKind, read func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, spanName, trace.WithAttributes(attribute.String("gvk", gvk.String())))
+	defer span.End()
+
+	err := read(ctx)
+	switch {
+	case err == nil:
+		span.SetAttributes(attribute.String("result", "found"))
+	case apierrors.IsNotFound(err):
+		span.SetAttributes(attribute.String("result", "notfound"))
+	default:
+		span.SetAttributes(attribute.String("result", "error"))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package dynamiccache
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// InputResourceTransform returns a cache transform that drops the managedFields of every object
+// when stripManagedFields is set, and the status of objects of the given kinds.
+// Everything the filters and the reconciler read, like the name, namespace, labels, resourceVersion and uid, is kept.
+// It returns nil when there is nothing to strip.
+func InputResourceTransform(scheme *runtime.Scheme, stripManagedFields bool, stripStatusKinds sets.Set[schema.GroupKind]) toolscache.TransformFunc {
+	if !stripManagedFields && stripStatusKinds.Len() == 0 {
+		return nil
+	}
+	return func(in interface{}) (interface{}, error) {
+		obj, ok := in.(client.Object)
+		if !ok {
+			// e.g. tombstones, their object has already been transformed
+			return in, nil
+		}
+		if stripManagedFields {
+			obj.SetManagedFields(nil)
+		}
+		if stripStatusKinds.Len() > 0 {
+			gvk, err := apiutil.GVKForObject(obj, scheme)
+			if err == nil && stripStatusKinds.Has(gvk.GroupKind()) {
+				stripStatus(obj)
+			}
+		}
+		return obj, nil
+	}
+}
+
+// stripStatus clears the status of the object, typed objects without a Status field are left untouched.
+func stripStatus(obj client.Object) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		unstructured.RemoveNestedField(u.Object, "status")
+		return
+	}
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	status := v.Elem().FieldByName("Status")
+	if status.IsValid() && status.CanSet() {
+		status.Set(reflect.Zero(status.Type()))
+	}
+}
+
+// GroupKindsFor parses kinds written as "Kind.group", e.g. "Deployment.apps", or "Kind" for the core group.
+func GroupKindsFor(kinds []string) sets.Set[schema.GroupKind] {
+	groupKinds := sets.New[schema.GroupKind]()
+	for _, kind := range kinds {
+		groupKinds.Insert(schema.ParseGroupKind(kind))
+	}
+	return groupKinds
+}
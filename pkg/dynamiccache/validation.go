@@ -0,0 +1,51 @@
+package dynamiccache
+
+import (
+	"fmt"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// validateInputResources checks that the input resources are complete before they are resolved,
+// a missing resource or version would otherwise surface as an obscure RESTMapper error.
+// The refinements of the operators, keyed by the operator name, must refine resources the operators declared.
+// All invalid entries are reported, not only the first one.
+func validateInputResources(inputResources map[string]*libraryinputresources.InputResources, refinements map[string]*InputResourceRefinements) error {
+	var errs []error
+	for _, operator := range sets.List(sets.KeySet(inputResources)) {
+		if operator == "" {
+			errs = append(errs, fmt.Errorf("the operator name must not be empty"))
+		}
+		resources := inputResources[operator]
+		if resources == nil {
+			errs = append(errs, fmt.Errorf("operator %q: no input resources declared", operator))
+			continue
+		}
+		for _, list := range resourceListsOf(resources) {
+			for idx, def := range list.ExactResources {
+				if err := validateInputResourceTypeIdentifier(def.InputResourceTypeIdentifier); err != nil {
+					errs = append(errs, fmt.Errorf("operator %q: %s exact resource #%d (namespace=%q, name=%q): %w", operator, list.category, idx, def.Namespace, def.Name, err))
+				}
+			}
+			for idx, def := range list.LabelSelectedResources {
+				if err := validateInputResourceTypeIdentifier(def.InputResourceTypeIdentifier); err != nil {
+					errs = append(errs, fmt.Errorf("operator %q: %s label selected resource #%d (namespace=%q): %w", operator, list.category, idx, def.Namespace, err))
+				}
+			}
+		}
+		errs = append(errs, validateInputResourceRefinements(operator, resources, refinements[operator])...)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func validateInputResourceTypeIdentifier(id libraryinputresources.InputResourceTypeIdentifier) error {
+	if id.Resource == "" {
+		return fmt.Errorf("the resource must not be empty")
+	}
+	if id.Version == "" && id.Group != "" {
+		return fmt.Errorf("the version of group %q must not be empty", id.Group)
+	}
+	return nil
+}
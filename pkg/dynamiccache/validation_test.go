@@ -0,0 +1,145 @@
+package dynamiccache
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	libraryinputresources "github.com/openshift/multi-operator-manager/pkg/library/libraryinputresources"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestValidateInputResources(t *testing.T) {
+	tests := []struct {
+		name           string
+		inputResources map[string]*libraryinputresources.InputResources
+		refinements    map[string]*InputResourceRefinements
+		// wantErrs are the aggregated errors expected, in order
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources(
+					[]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "config"), exactResource("apps", "v1", "deployments", "ns", "deployment")},
+					labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "a"}),
+				),
+			},
+		},
+		{
+			name: "empty resource",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "", "ns", "config")}),
+			},
+			wantErrs: []string{`operator "a": applyConfiguration exact resource #0 (namespace="ns", name="config"): the resource must not be empty`},
+		},
+		{
+			name: "missing version of a non-core group",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources(nil, labelSelectedResource("apps", "", "deployments", "ns", map[string]string{"app": "a"})),
+			},
+			wantErrs: []string{`operator "a": applyConfiguration label selected resource #0 (namespace="ns"): the version of group "apps" must not be empty`},
+		},
+		{
+			name: "missing version of the core group",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "", "configmaps", "ns", "config")}),
+			},
+		},
+		{
+			name: "no input resources",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": nil,
+			},
+			wantErrs: []string{`operator "a": no input resources declared`},
+		},
+		{
+			name: "refined label selected resource",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "a"})),
+			},
+			refinements: map[string]*InputResourceRefinements{
+				"a": {LabelSelectedResources: []LabelSelectedResource{{
+					LabelSelectedResource: labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "a"}),
+					Annotation:            &AnnotationMatch{Key: "example.com/input"},
+				}}},
+				// the refinements of operators added later on aren't validated until they are added
+				"b": {LabelSelectedResources: []LabelSelectedResource{{LabelSelectedResource: labelSelectedResource("", "v1", "secrets", "ns", nil)}}},
+			},
+		},
+		{
+			name: "refinement of an undeclared label selected resource",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources(nil, labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "a"})),
+			},
+			refinements: map[string]*InputResourceRefinements{
+				"a": {LabelSelectedResources: []LabelSelectedResource{{
+					LabelSelectedResource: labelSelectedResource("", "v1", "secrets", "ns", map[string]string{"app": "b"}),
+					Annotation:            &AnnotationMatch{Key: "example.com/input"},
+				}}},
+			},
+			wantErrs: []string{`operator "a": label selected resource refinement #0 (namespace="ns") doesn't refine any declared label selected resource`},
+		},
+		{
+			name: "refinement of an undeclared exact resource",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "config")}),
+			},
+			refinements: map[string]*InputResourceRefinements{
+				"a": {ExactResources: []ExactResource{
+					{ExactResourceID: exactResource("", "v1", "configmaps", "ns", "config"), UID: "uid"},
+					{ExactResourceID: exactResource("", "v1", "configmaps", "other", "config"), UID: "uid"},
+				}},
+			},
+			wantErrs: []string{`operator "a": exact resource refinement #1 (namespace="other", name="config") doesn't refine any declared exact resource`},
+		},
+		{
+			name: "invalid name regex",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "configmaps", "ns", "")}),
+			},
+			refinements: map[string]*InputResourceRefinements{
+				"a": {ExactResources: []ExactResource{{ExactResourceID: exactResource("", "v1", "configmaps", "ns", ""), NameRegex: "revision-("}}},
+			},
+			wantErrs: []string{"operator \"a\": exact resource refinement #0 (namespace=\"ns\", name=\"\"): invalid name regex \"revision-(\": error parsing regexp: missing closing ): `revision-(`"},
+		},
+		{
+			name: "errors of several operators are aggregated",
+			inputResources: map[string]*libraryinputresources.InputResources{
+				"b": applyConfigurationResources([]libraryinputresources.ExactResourceID{
+					exactResource("", "v1", "configmaps", "ns", "config"),
+					exactResource("apps", "", "deployments", "ns", "deployment"),
+				}),
+				"a": applyConfigurationResources([]libraryinputresources.ExactResourceID{exactResource("", "v1", "", "ns", "config")}),
+				"":  applyConfigurationResources(nil),
+			},
+			wantErrs: []string{
+				`the operator name must not be empty`,
+				`operator "a": applyConfiguration exact resource #0 (namespace="ns", name="config"): the resource must not be empty`,
+				`operator "b": applyConfiguration exact resource #1 (namespace="ns", name="deployment"): the version of group "apps" must not be empty`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInputResources(tt.inputResources, tt.refinements)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var aggregate utilerrors.Aggregate
+			if !errors.As(err, &aggregate) {
+				t.Fatalf("expected an aggregated error, got %v", err)
+			}
+			var got []string
+			for _, err := range aggregate.Errors() {
+				got = append(got, err.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.wantErrs, "\n") {
+				t.Errorf("expected the errors:\n%s\ngot:\n%s", strings.Join(tt.wantErrs, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
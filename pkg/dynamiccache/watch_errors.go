@@ -0,0 +1,50 @@
+package dynamiccache
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/go-logr/logr"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+// NewWatchErrorHandler returns a watch error handler for the informers of the cluster,
+// to be set as the DefaultWatchErrorHandler of its cache options.
+// It logs every dropped watch with the type of its informer, counts it in the watch errors metric
+// and passes it on to the client-go default handler. The informer backs off and reconnects on its own once it returns.
+func NewWatchErrorHandler(log logr.Logger, clusterName string) toolscache.WatchErrorHandlerWithContext {
+	return func(ctx context.Context, r *toolscache.Reflector, err error) {
+		handleWatchError(log, clusterName, r.TypeDescription(), err)
+		toolscache.DefaultWatchErrorHandler(ctx, r, err)
+	}
+}
+
+// handleWatchError logs and counts a dropped watch, watches closed normally aren't errors.
+func handleWatchError(log logr.Logger, clusterName, watchedType string, err error) {
+	if errors.Is(err, io.EOF) {
+		return
+	}
+	watchErrorsTotal.WithLabelValues(clusterName, watchedType).Inc()
+	log.Info("warning: watch dropped, reconnecting with a backoff", "cluster", clusterName, "type", watchedType, "err", err.Error())
+}
+
+// setWatchErrorHandler sets a watch error handler reporting the GVK on the informer.
+// The handler can only be set before the informer starts, which the cache does as soon as it returns the informer once started,
+// so it is usually left to the cache-wide handler, see NewWatchErrorHandler. Informers that don't support it are left alone.
+func (i *InputResourceInitializer) setWatchErrorHandler(gvk string, informer cache.Informer) {
+	settable, ok := informer.(interface {
+		SetWatchErrorHandlerWithContext(handler toolscache.WatchErrorHandlerWithContext) error
+	})
+	if !ok {
+		return
+	}
+	err := settable.SetWatchErrorHandlerWithContext(func(ctx context.Context, r *toolscache.Reflector, err error) {
+		handleWatchError(i.log, i.cluster.Name, gvk, err)
+		toolscache.DefaultWatchErrorHandler(ctx, r, err)
+	})
+	if err != nil {
+		i.log.V(1).Info("unable to set the watch error handler of the informer, leaving it to the cache", "gvk", gvk, "err", err.Error())
+	}
+}